@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type accessLogConfig struct {
+	Sink       string
+	FilePath   string
+	MaxSizeMB  int
+	MaxBackups int
+	SyslogAddr string
+	SampleRate float64
+}
+
+func accessLogConfigFromEnv() (accessLogConfig, error) {
+	config := accessLogConfig{
+		Sink:       configOrDefault("ACCESS_LOG_SINK", "stdout"),
+		FilePath:   configOrDefault("ACCESS_LOG_FILE", "./logs/access.log"),
+		MaxSizeMB:  100,
+		MaxBackups: 5,
+		SyslogAddr: configValue("ACCESS_LOG_SYSLOG_ADDR"),
+		SampleRate: 1,
+	}
+
+	switch config.Sink {
+	case "stdout", "file", "syslog":
+	default:
+		return config, fmt.Errorf("ACCESS_LOG_SINK must be stdout, file or syslog, got %q", config.Sink)
+	}
+
+	var err error
+	if value := configValue("ACCESS_LOG_MAX_SIZE_MB"); value != "" {
+		if config.MaxSizeMB, err = strconv.Atoi(value); err != nil || config.MaxSizeMB < 1 {
+			return config, fmt.Errorf("ACCESS_LOG_MAX_SIZE_MB must be a positive integer, got %q", value)
+		}
+	}
+	if value := configValue("ACCESS_LOG_MAX_BACKUPS"); value != "" {
+		if config.MaxBackups, err = strconv.Atoi(value); err != nil || config.MaxBackups < 0 {
+			return config, fmt.Errorf("ACCESS_LOG_MAX_BACKUPS must be a non-negative integer, got %q", value)
+		}
+	}
+	if value := configValue("ACCESS_LOG_SAMPLE_RATE"); value != "" {
+		if config.SampleRate, err = strconv.ParseFloat(value, 64); err != nil || config.SampleRate < 0 || config.SampleRate > 1 {
+			return config, fmt.Errorf("ACCESS_LOG_SAMPLE_RATE must be between 0 and 1, got %q", value)
+		}
+	}
+	return config, nil
+}
+
+func newAccessLogWriter(config accessLogConfig) (io.Writer, error) {
+	switch config.Sink {
+	case "file":
+		return newRotatingFile(config.FilePath, int64(config.MaxSizeMB)<<20, config.MaxBackups)
+	case "syslog":
+		return newSyslogWriter(config.SyslogAddr)
+	}
+	return os.Stdout, nil
+}
+
+// accessLog logs one JSON line per request. Client and server errors are
+// always logged; other responses are sampled at config.SampleRate.
+func accessLog(config accessLogConfig) (gin.HandlerFunc, error) {
+	writer, err := newAccessLogWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	logger := slog.New(requestIDHandler{slog.NewJSONHandler(writer, nil)})
+
+	return func(ginContext *gin.Context) {
+		start := time.Now()
+		ginContext.Next()
+
+		status := ginContext.Writer.Status()
+		if status < 400 && config.SampleRate < 1 && rand.Float64() >= config.SampleRate {
+			return
+		}
+
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", ginContext.Request.Method),
+			slog.String("path", ginContext.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", ginContext.ClientIP()),
+			slog.Int("bytes", ginContext.Writer.Size()),
+		}
+		if len(ginContext.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", ginContext.Errors.String()))
+		}
+		logger.LogAttrs(ginContext.Request.Context(), level, "request", attrs...)
+	}, nil
+}
+
+// rotatingFile is an append-only log file that is renamed aside once it
+// reaches maxSize bytes, keeping at most maxBackups rotated files.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rotating := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+	return rotating, nil
+}
+
+func (rotating *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rotating.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rotating.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rotating.file = file
+	rotating.size = info.Size()
+	return nil
+}
+
+func (rotating *rotatingFile) Write(p []byte) (int, error) {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+
+	if rotating.size > 0 && rotating.size+int64(len(p)) > rotating.maxSize {
+		if err := rotating.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rotating.file.Write(p)
+	rotating.size += int64(n)
+	return n, err
+}
+
+func (rotating *rotatingFile) rotate() error {
+	if err := rotating.file.Close(); err != nil {
+		return err
+	}
+	rotated := rotating.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(rotating.path, rotated); err != nil {
+		return err
+	}
+	if err := rotating.open(); err != nil {
+		return err
+	}
+
+	backups, err := filepath.Glob(rotating.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > rotating.maxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
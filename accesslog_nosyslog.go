@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogWriter(addr string) (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,16 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+)
+
+func newSyslogWriter(addr string) (io.Writer, error) {
+	network := ""
+	if addr != "" {
+		network = "udp"
+	}
+	return syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, "go-simple-crud-mysql")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	minJWTSecretLength  = 32
+	maxPasswordBytes    = 72
+	userIDKey           = "userID"
+	mysqlDuplicateEntry = 1062
+)
+
+var (
+	errInvalidToken       = newDomainError(errUnauthorized, "missing, invalid or expired token")
+	errInvalidCredentials = newDomainError(errUnauthorized, "invalid email or password")
+	errEmailTaken         = newDomainError(errConflict, "email is already registered")
+)
+
+type authConfig struct {
+	Secret   []byte
+	TokenTTL time.Duration
+}
+
+// generatedJWTSecret signs tokens when JWT_SECRET is unset. It changes on
+// every start, so such tokens do not survive a restart and are not accepted
+// by other instances.
+var generatedJWTSecret = randomSecret()
+
+func randomSecret() []byte {
+	secret := make([]byte, minJWTSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+func authConfigFromEnv() (authConfig, error) {
+	config := authConfig{Secret: generatedJWTSecret, TokenTTL: 24 * time.Hour}
+	if secret := configValue("JWT_SECRET"); secret != "" {
+		if len(secret) < minJWTSecretLength {
+			return config, fmt.Errorf("JWT_SECRET must be at least %d characters", minJWTSecretLength)
+		}
+		config.Secret = []byte(secret)
+	}
+	if value := configValue("JWT_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return config, fmt.Errorf("JWT_TTL must be a positive duration such as 24h, got %q", value)
+		}
+		config.TokenTTL = ttl
+	}
+	return config, nil
+}
+
+// Tokens are HS256 JWTs whose subject is the user id.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func signToken(secret []byte, claims tokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(secret, unsigned), nil
+}
+
+func tokenSignature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseToken returns the user id of a valid, unexpired token. Only the exact
+// header signToken writes is accepted, so a token cannot choose its own
+// algorithm.
+func parseToken(secret []byte, token string, now time.Time) (int64, error) {
+	header, rest, _ := strings.Cut(token, ".")
+	payload, signature, ok := strings.Cut(rest, ".")
+	if !ok || header != jwtHeader || !hmac.Equal([]byte(signature), []byte(tokenSignature(secret, header+"."+payload))) {
+		return 0, errInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, errInvalidToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil || now.Unix() >= claims.ExpiresAt {
+		return 0, errInvalidToken
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, errInvalidToken
+	}
+	return userID, nil
+}
+
+// requireUser authenticates the request with its bearer token. Handlers
+// behind it read the user with currentUserID.
+func requireUser(config authConfig) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		token, ok := strings.CutPrefix(ginContext.GetHeader("Authorization"), "Bearer ")
+		userID, err := parseToken(config.Secret, token, time.Now())
+		if !ok || err != nil {
+			ginContext.Header("WWW-Authenticate", "Bearer")
+			ginContext.Error(errInvalidToken)
+			ginContext.Abort()
+			return
+		}
+		ginContext.Set(userIDKey, userID)
+		ginContext.Next()
+	}
+}
+
+func currentUserID(ginContext *gin.Context) int64 {
+	return ginContext.GetInt64(userIDKey)
+}
+
+type user struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// The max rule counts characters, but bcrypt only takes passwords of up to
+// maxPasswordBytes bytes; userService.Register checks the byte length as
+// well.
+type credentialsPayload struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+var errPasswordTooLong = &domainError{
+	kind:    errValidation,
+	message: "invalid request body",
+	details: []fieldError{{Field: "password", Rule: "max_bytes", Param: strconv.Itoa(maxPasswordBytes)}},
+}
+
+type authResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      user      `json:"user"`
+}
+
+func issueToken(config authConfig, u user) (authResponse, error) {
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := issuedAt.Add(config.TokenTTL)
+	token, err := signToken(config.Secret, tokenClaims{
+		Subject:   strconv.FormatInt(u.ID, 10),
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	return authResponse{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt, User: u}, err
+}
+
+func register(config authConfig, users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload credentialsPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		u, err := users.Register(ginContext.Request.Context(), payload.Email, payload.Password)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		response, err := issueToken(config, u)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusCreated, response)
+	}
+}
+
+func login(config authConfig, users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload credentialsPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		u, err := users.Login(ginContext.Request.Context(), payload.Email, payload.Password)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		response, err := issueToken(config, u)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, response)
+	}
+}
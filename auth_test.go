@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func testToken(t *testing.T, secret []byte, expiresAt time.Time) string {
+	t.Helper()
+	token, err := signToken(secret, tokenClaims{Subject: "7", IssuedAt: expiresAt.Add(-time.Hour).Unix(), ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// tokenWithHeader signs the claims of token under another header, as a
+// forged token choosing its own algorithm would.
+func tokenWithHeader(token, header string) string {
+	_, rest, _ := strings.Cut(token, ".")
+	payload, _, _ := strings.Cut(rest, ".")
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + payload
+	return unsigned + "." + tokenSignature(testSecret, unsigned)
+}
+
+func TestParseToken(t *testing.T) {
+	now := time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC)
+	valid := testToken(t, testSecret, now.Add(time.Hour))
+	header, rest, _ := strings.Cut(valid, ".")
+	payload, signature, _ := strings.Cut(rest, ".")
+
+	userID, err := parseToken(testSecret, valid, now)
+	if err != nil || userID != 7 {
+		t.Fatalf("valid token: got %d, %v, want 7", userID, err)
+	}
+
+	for name, token := range map[string]string{
+		"bad signature":    header + "." + payload + "." + strings.Repeat("A", len(signature)),
+		"other secret":     testToken(t, []byte("another secret of at least 32 bytes"), now.Add(time.Hour)),
+		"alg none":         tokenWithHeader(valid, `{"alg":"none","typ":"JWT"}`),
+		"alg HS512":        tokenWithHeader(valid, `{"alg":"HS512","typ":"JWT"}`),
+		"expired":          testToken(t, testSecret, now),
+		"empty":            "",
+		"one segment":      header,
+		"two segments":     header + "." + payload,
+		"four segments":    valid + "." + signature,
+		"payload not b64":  header + ".!!!." + tokenSignature(testSecret, header+".!!!"),
+		"payload not json": header + ".bm90IGpzb24." + tokenSignature(testSecret, header+".bm90IGpzb24"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseToken(testSecret, token, now); !errors.Is(err, errInvalidToken) {
+				t.Errorf("got %v, want errInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestRegisterRejectsPasswordsOverBcryptLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(mapErrors)
+	router.POST("/auth/register", register(authConfig{Secret: testSecret, TokenTTL: time.Hour}, userService{repo: newMemoryUserRepository()}))
+
+	// 72 characters pass the max rule but take 144 bytes.
+	body, _ := json.Marshal(credentialsPayload{Email: "jane@example.com", Password: strings.Repeat("é", 72)})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(string(body))))
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"rule":"max_bytes"`) {
+		t.Fatalf("got %d %s, want 400 with a max_bytes rule", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	backupVersion    = 1
+	backupFilePrefix = "backup-"
+	backupTimeLayout = "20060102T150405Z"
+
+	// maxBackupUploadBytes caps the body of POST /me/backup.
+	maxBackupUploadBytes = 32 << 20
+)
+
+// A dump's scope tells a dump of the whole database, which only the restore
+// command accepts, from one user's todos, which only POST /me/backup
+// accepts. Dumps written before scopes existed are full when they have
+// users.
+const (
+	backupScopeFull = "full"
+	backupScopeUser = "user"
+)
+
+// allUsers asks todoService.Backup for the whole database rather than one user's
+// todos.
+const allUsers = 0
+
+type backupUser struct {
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"password_hash"`
+	FeedTokenHash *string   `json:"feed_token_hash,omitempty"`
+	APIKeyHash    *string   `json:"api_key_hash,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type backupTodo struct {
+	ID              int        `json:"id"`
+	UserID          *int       `json:"user_id,omitempty"`
+	Item            string     `json:"item"`
+	Completed       bool       `json:"completed"`
+	EstimateMinutes *int       `json:"estimate_minutes"`
+	DueDate         *time.Time `json:"due_date,omitempty"`
+	Priority        *string    `json:"priority,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+type backupTimeEntry struct {
+	ID        int        `json:"id"`
+	TodoID    int        `json:"todo_id"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+}
+
+type backup struct {
+	Version     int               `json:"version"`
+	Scope       string            `json:"scope"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Users       []backupUser      `json:"users,omitempty"`
+	Todos       []backupTodo      `json:"todos"`
+	TimeEntries []backupTimeEntry `json:"time_entries"`
+}
+
+// checkBackup rejects dumps of another version or scope before anything is
+// written.
+func checkBackup(dump backup, scope string) error {
+	if dump.Version != backupVersion {
+		return newDomainError(errValidation, fmt.Sprintf("unsupported backup version %d", dump.Version))
+	}
+	dumpScope := dump.Scope
+	if dumpScope == "" {
+		dumpScope = backupScopeUser
+		if len(dump.Users) > 0 {
+			dumpScope = backupScopeFull
+		}
+	}
+	if dumpScope != scope {
+		return newDomainError(errValidation, fmt.Sprintf("expected a %s backup, got a %s backup", scope, dumpScope))
+	}
+	return nil
+}
+
+// validateBackup holds the todos of an uploaded backup to the rules of
+// POST /todos, so a bad dump is rejected before anything is written.
+func validateBackup(dump backup) error {
+	todoIDs := make(map[int]bool, len(dump.Todos))
+	for _, t := range dump.Todos {
+		payload := todoPayload{
+			Item:            t.Item,
+			Completed:       t.Completed,
+			EstimateMinutes: t.EstimateMinutes,
+			DueDate:         t.DueDate,
+			Priority:        t.Priority,
+			Tags:            t.Tags,
+		}
+		if err := binding.Validator.ValidateStruct(payload); err != nil {
+			return invalidInput(fmt.Sprintf("todo %d in the backup is invalid", t.ID), err)
+		}
+		todoIDs[t.ID] = true
+	}
+
+	for _, entry := range dump.TimeEntries {
+		if !todoIDs[entry.TodoID] {
+			return newDomainError(errValidation,
+				fmt.Sprintf("time entry %d belongs to todo %d, which is not in the backup", entry.ID, entry.TodoID),
+			)
+		}
+	}
+	return nil
+}
+
+func getBackup(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		dump, err := todos.Backup(ginContext.Request.Context(), currentUserID(ginContext))
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		filename := backupFilePrefix + dump.CreatedAt.Format(backupTimeLayout) + ".json"
+		ginContext.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ginContext.JSON(http.StatusOK, dump)
+	}
+}
+
+func restoreBackupFromRequest(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		mode := ginContext.DefaultQuery("mode", "merge")
+		if mode != "merge" && mode != "replace" {
+			ginContext.Error(newDomainError(errValidation, "mode must be merge or replace"))
+			return
+		}
+
+		ginContext.Request.Body = http.MaxBytesReader(ginContext.Writer, ginContext.Request.Body, maxBackupUploadBytes)
+		var dump backup
+		if err := ginContext.ShouldBindJSON(&dump); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ginContext.Error(newDomainError(errValidation, fmt.Sprintf("backup must not exceed %d MiB", maxBackupUploadBytes>>20)))
+				return
+			}
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		err := todos.MergeBackup(ginContext.Request.Context(), currentUserID(ginContext), dump, mode == "replace")
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, gin.H{"mode": mode, "todos": len(dump.Todos), "time_entries": len(dump.TimeEntries)})
+	}
+}
+
+func runBackup(ctx context.Context, todos todoService, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := flags.String("dir", "./backups", "directory to write the backup to")
+	keep := flags.Int("keep", 7, "number of most recent backups to keep, 0 keeps all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dump, err := todos.Backup(ctx, allUsers)
+	if err != nil {
+		return fmt.Errorf("dumping database: %w", err)
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(*dir, backupFilePrefix+dump.CreatedAt.Format(backupTimeLayout)+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s (%d users, %d todos, %d time entries)\n", path, len(dump.Users), len(dump.Todos), len(dump.TimeEntries))
+
+	return pruneBackups(*dir, *keep)
+}
+
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, backupFilePrefix+"*.json"))
+	if err != nil {
+		return err
+	}
+
+	// The timestamp layout sorts lexically, so the oldest backups come first.
+	sort.Strings(files)
+	for len(files) > keep {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", files[0])
+		files = files[1:]
+	}
+	return nil
+}
+
+func runRestore(ctx context.Context, todos todoService, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	file := flags.String("file", "", "backup file to restore")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*file) == "" {
+		return fmt.Errorf("restore: -file is required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	var dump backup
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return fmt.Errorf("reading %s: %w", *file, err)
+	}
+
+	if err := todos.RestoreBackup(ctx, dump); err != nil {
+		return fmt.Errorf("restoring database: %w", err)
+	}
+	fmt.Printf("Restored %d users, %d todos and %d time entries from %s\n", len(dump.Users), len(dump.Todos), len(dump.TimeEntries), *file)
+	return nil
+}
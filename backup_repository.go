@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Backup reads the user's todos and time entries, or with allUsers every
+// table including the users and who owns each todo, inside one read-only
+// REPEATABLE READ transaction, so the dump is a consistent snapshot even
+// while the API is serving writes.
+func (mysqlTodoRepository) Backup(ctx context.Context, userID int64) (backup, error) {
+	dump := backup{
+		Version:     backupVersion,
+		Scope:       backupScopeUser,
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		Todos:       []backupTodo{},
+		TimeEntries: []backupTimeEntry{},
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return dump, err
+	}
+	defer tx.Rollback()
+
+	if userID == allUsers {
+		dump.Scope = backupScopeFull
+		if dump.Users, err = dumpUsers(ctx, tx); err != nil {
+			return dump, err
+		}
+	}
+
+	selectBackupTodos := "SELECT id, user_id, item, completed, estimate_minutes, due_date, priority, " + todoTagsColumn +
+		", created_at, completed_at, deleted_at FROM todos"
+	selectBackupTimeEntries := "SELECT id, todo_id, started_at, stopped_at FROM time_entries"
+	var args []any
+	if userID != allUsers {
+		selectBackupTodos += " WHERE user_id = ?"
+		selectBackupTimeEntries += " WHERE todo_id IN (SELECT id FROM todos WHERE user_id = ?)"
+		args = append(args, userID)
+	}
+
+	rows, err := tx.QueryContext(ctx, selectBackupTodos+" ORDER BY id", args...)
+	if err != nil {
+		return dump, err
+	}
+	for rows.Next() {
+		var t backupTodo
+		var tags sql.NullString
+		err := rows.Scan(
+			&t.ID, &t.UserID, &t.Item, &t.Completed, &t.EstimateMinutes, &t.DueDate, &t.Priority, &tags,
+			&t.CreatedAt, &t.CompletedAt, &t.DeletedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return dump, err
+		}
+		t.Tags = splitTags(tags)
+		if userID != allUsers {
+			t.UserID = nil
+		}
+		dump.Todos = append(dump.Todos, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return dump, err
+	}
+
+	rows, err = tx.QueryContext(ctx, selectBackupTimeEntries+" ORDER BY id", args...)
+	if err != nil {
+		return dump, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry backupTimeEntry
+		if err := rows.Scan(&entry.ID, &entry.TodoID, &entry.StartedAt, &entry.StoppedAt); err != nil {
+			return dump, err
+		}
+		dump.TimeEntries = append(dump.TimeEntries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return dump, err
+	}
+
+	return dump, tx.Commit()
+}
+
+func dumpUsers(ctx context.Context, tx *sql.Tx) ([]backupUser, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, email, password_hash, feed_token_hash, api_key_hash, created_at FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users = []backupUser{}
+	for rows.Next() {
+		var u backupUser
+		if err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.FeedTokenHash, &u.APIKeyHash, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// RestoreBackup replaces the contents of every table with the dump.
+func (mysqlTodoRepository) RestoreBackup(ctx context.Context, dump backup) error {
+	return withTx(ctx, func(tx *sql.Tx) error {
+		for _, statement := range []string{
+			"DELETE FROM todo_tags", "DELETE FROM tags", "DELETE FROM time_entries", "DELETE FROM todos", "DELETE FROM users",
+		} {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+
+		for _, u := range dump.Users {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO users (id, email, password_hash, feed_token_hash, api_key_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+				u.ID, u.Email, u.PasswordHash, u.FeedTokenHash, u.APIKeyHash, u.CreatedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("restoring user %d: %w", u.ID, err)
+			}
+		}
+
+		for _, t := range dump.Todos {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO todos (id, user_id, item, completed, estimate_minutes, due_date, priority, created_at, completed_at, deleted_at)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				t.ID, t.UserID, t.Item, t.Completed, t.EstimateMinutes, t.DueDate, t.Priority, t.CreatedAt, t.CompletedAt, t.DeletedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("restoring todo %d: %w", t.ID, err)
+			}
+			// Tags belong to users, so those of ownerless todos are dropped.
+			if t.UserID != nil {
+				if err := setTodoTags(ctx, tx, int64(*t.UserID), int64(t.ID), t.Tags); err != nil {
+					return fmt.Errorf("restoring tags of todo %d: %w", t.ID, err)
+				}
+			}
+		}
+
+		for _, entry := range dump.TimeEntries {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO time_entries (id, todo_id, started_at, stopped_at) VALUES (?, ?, ?, ?)",
+				entry.ID, entry.TodoID, entry.StartedAt, entry.StoppedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("restoring time entry %d: %w", entry.ID, err)
+			}
+		}
+		return touchAllTodos(ctx, tx)
+	})
+}
+
+// MergeBackup adds the dump's todos to the user's as new rows and remaps its
+// time entries onto the new todo ids. With replace the user's existing todos
+// are deleted first. Users and owners in the dump are ignored.
+func (mysqlTodoRepository) MergeBackup(ctx context.Context, userID int64, dump backup, replace bool) error {
+	return withTx(ctx, func(tx *sql.Tx) error {
+		if replace {
+			// Their time entries go with them through the foreign key.
+			if _, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE user_id = ?", userID); err != nil {
+				return err
+			}
+		}
+
+		todoIDs := make(map[int]int64, len(dump.Todos))
+		for _, t := range dump.Todos {
+			result, err := tx.ExecContext(ctx,
+				`INSERT INTO todos (user_id, item, completed, estimate_minutes, due_date, priority, created_at, completed_at, deleted_at)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				userID, t.Item, t.Completed, t.EstimateMinutes, t.DueDate, t.Priority, t.CreatedAt, t.CompletedAt, t.DeletedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("merging todo %d: %w", t.ID, err)
+			}
+			if todoIDs[t.ID], err = result.LastInsertId(); err != nil {
+				return err
+			}
+			if err := setTodoTags(ctx, tx, userID, todoIDs[t.ID], t.Tags); err != nil {
+				return fmt.Errorf("merging tags of todo %d: %w", t.ID, err)
+			}
+		}
+
+		for _, entry := range dump.TimeEntries {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO time_entries (todo_id, started_at, stopped_at) VALUES (?, ?, ?)",
+				todoIDs[entry.TodoID], entry.StartedAt, entry.StoppedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("merging time entry %d: %w", entry.ID, err)
+			}
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Batches are capped at 100 todos, as each runs in a single transaction.
+type todosBatchCreatePayload struct {
+	Todos []todoPayload `json:"todos" binding:"required,min=1,max=100,dive"`
+}
+
+type todosBatchCompletePayload struct {
+	IDs       []int64 `json:"ids" binding:"required,min=1,max=100,dive,min=1"`
+	Completed *bool   `json:"completed" binding:"required"`
+}
+
+type todosBatchDeletePayload struct {
+	IDs []int64 `json:"ids" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+type todosBatchResponse struct {
+	Todos []todo `json:"todos"`
+}
+
+// createTodosBatch stores a batch of todos at once, so clients syncing
+// offline changes do not need a request per todo.
+func createTodosBatch(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload todosBatchCreatePayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		createdTodos, err := todos.CreateMany(ginContext.Request.Context(), currentUserID(ginContext), payload.Todos)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusCreated, todosBatchResponse{Todos: createdTodos})
+	}
+}
+
+func completeTodosBatch(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload todosBatchCompletePayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		updatedTodos, err := todos.SetCompleted(ginContext.Request.Context(), currentUserID(ginContext), payload.IDs, *payload.Completed)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, todosBatchResponse{Todos: updatedTodos})
+	}
+}
+
+func deleteTodosBatch(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload todosBatchDeletePayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		deletedTodos, err := todos.DeleteMany(ginContext.Request.Context(), currentUserID(ginContext), payload.IDs)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		respondDeleted(ginContext, todosBatchResponse{Todos: deletedTodos})
+	}
+}
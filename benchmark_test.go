@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The benchmarks cover the read path from scanning rows to writing the
+// response; run them with -benchmem to compare allocations per request.
+
+var benchmarkCompletedAt = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeTodoRow fills the columns of selectTodos like a driver row would.
+type fakeTodoRow struct{}
+
+func (fakeTodoRow) Scan(dest ...any) error {
+	for i, target := range dest {
+		switch target := target.(type) {
+		case *int:
+			*target = 42
+		case *string:
+			*target = "Buy groceries"
+		case *bool:
+			*target = true
+		case **int:
+			*target = nil
+		case **string:
+			*target = nil
+		case *sql.NullString:
+			*target = sql.NullString{String: "errands,home", Valid: true}
+		case *int64:
+			*target = 1500
+		case *time.Time:
+			*target = benchmarkCompletedAt
+		case **time.Time:
+			if i == len(dest)-2 {
+				completedAt := benchmarkCompletedAt
+				*target = &completedAt
+			} else {
+				*target = nil
+			}
+		}
+	}
+	return nil
+}
+
+// todoRowsDriver is a database/sql driver answering every query with
+// todoRowsPerQuery rows of selectTodos columns, so the repository can be
+// benchmarked without MySQL.
+type todoRowsDriver struct{}
+
+const todoRowsPerQuery = defaultTodoPageLimit
+
+func (todoRowsDriver) Open(string) (driver.Conn, error) { return todoRowsConn{}, nil }
+
+type todoRowsConn struct{}
+
+func (todoRowsConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (todoRowsConn) Close() error { return nil }
+func (todoRowsConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+func (todoRowsConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &todoRows{}, nil
+}
+
+type todoRows struct {
+	sent int
+}
+
+func (*todoRows) Columns() []string {
+	return []string{
+		"id", "item", "completed", "estimate_minutes", "due_date", "priority", "tags",
+		"tracked_seconds", "created_at", "completed_at", "deleted_at",
+	}
+}
+func (*todoRows) Close() error { return nil }
+func (rows *todoRows) Next(dest []driver.Value) error {
+	if rows.sent == todoRowsPerQuery {
+		return io.EOF
+	}
+	rows.sent++
+	values := []driver.Value{
+		int64(rows.sent), []byte("Buy groceries"), int64(1), nil, nil, nil, []byte("errands,home"),
+		int64(1500), benchmarkCompletedAt, benchmarkCompletedAt, nil,
+	}
+	copy(dest, values)
+	return nil
+}
+
+func init() {
+	sql.Register("todorows", todoRowsDriver{})
+}
+
+// setUpBenchmark registers the todo routes for linksForTodo, points the
+// global db at todoRowsDriver and returns a service over it.
+func setUpBenchmark(b *testing.B) todoService {
+	b.Helper()
+	gin.SetMode(gin.ReleaseMode)
+	svc := newTodoService(mysqlTodoRepository{})
+	router := gin.New()
+	todos := router.Group("/todos")
+	todos.GET("", getTodos(svc))
+	todos.GET("/trash", getTrash(svc))
+	todo := todos.Group("/:id")
+	todo.GET("", getTodo(svc))
+	todo.PATCH("", toggleTodoStatus(svc))
+	todo.DELETE("", deleteTodo(svc))
+	todo.POST("/restore", restoreTodo(svc))
+	todo.DELETE("/purge", purgeTodo(svc))
+	registerTodoLinks(router.Routes())
+
+	fakeDB, err := sql.Open("todorows", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	saved := db
+	db = fakeDB
+	b.Cleanup(func() {
+		db = saved
+		fakeDB.Close()
+	})
+	b.ReportAllocs()
+	return svc
+}
+
+func BenchmarkScanTodo(b *testing.B) {
+	setUpBenchmark(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := scanTodo(fakeTodoRow{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryTodos(b *testing.B) {
+	setUpBenchmark(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		if _, err := queryTodos(ctx, selectTodos); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStreamTodos(b *testing.B) {
+	svc := setUpBenchmark(b)
+	page := todoPage{userID: 1, query: todoListQuery{page: 1, limit: defaultTodoPageLimit}}
+	for i := 0; i < b.N; i++ {
+		ginContext, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ginContext.Request = httptest.NewRequest(http.MethodGet, "/todos", nil)
+		if !streamTodos(ginContext, svc, page) {
+			b.Fatal(ginContext.Errors.Last())
+		}
+	}
+}
+
+// changedTodoRepository reports every user's todos as changed, so
+// getTodoChanges answers at once with the todos of todoRowsDriver.
+type changedTodoRepository struct {
+	mysqlTodoRepository
+}
+
+func (changedTodoRepository) LastModified(context.Context, int64) (time.Time, time.Time, error) {
+	return benchmarkCompletedAt, benchmarkCompletedAt, nil
+}
+
+func (changedTodoRepository) Count(context.Context, int64, todoListQuery) (int, error) {
+	return todoRowsPerQuery, nil
+}
+
+// BenchmarkGetTodoChanges runs the getTodoChanges handler from loading the
+// todos to encoding the response.
+func BenchmarkGetTodoChanges(b *testing.B) {
+	setUpBenchmark(b)
+	handler := getTodoChanges(newTodoService(changedTodoRepository{}))
+	for i := 0; i < b.N; i++ {
+		recorder := httptest.NewRecorder()
+		ginContext, _ := gin.CreateTestContext(recorder)
+		ginContext.Request = httptest.NewRequest(http.MethodGet, "/todos/changes", nil)
+		ginContext.Set(userIDKey, int64(1))
+		handler(ginContext)
+		if recorder.Code != http.StatusOK {
+			b.Fatalf("got %d, want 200", recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	calendarDateLayout = "2006-01-02"
+	maxCalendarDays    = 366
+)
+
+type calendarDay struct {
+	Date      string `json:"date"`
+	Created   []todo `json:"created"`
+	Completed []todo `json:"completed"`
+	Due       []todo `json:"due"`
+}
+
+type calendarResponse struct {
+	From string        `json:"from"`
+	To   string        `json:"to"`
+	Days []calendarDay `json:"days"`
+}
+
+func parseCalendarRange(ginContext *gin.Context) (time.Time, time.Time, error) {
+	from, err := time.Parse(calendarDateLayout, ginContext.Query("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, newDomainError(errValidation, "from must be a date in YYYY-MM-DD format")
+	}
+
+	to, err := time.Parse(calendarDateLayout, ginContext.Query("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, newDomainError(errValidation, "to must be a date in YYYY-MM-DD format")
+	}
+
+	if to.Before(from) || to.Sub(from) >= maxCalendarDays*24*time.Hour {
+		return time.Time{}, time.Time{}, newDomainError(errValidation, "to must not be before from and the range must not exceed 366 days")
+	}
+
+	return from, to, nil
+}
+
+func getTodosCalendar(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		from, to, err := parseCalendarRange(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+		until := to.AddDate(0, 0, 1)
+
+		days, err := todos.Calendar(ginContext.Request.Context(), currentUserID(ginContext), from, until)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, calendarResponse{
+			From: from.Format(calendarDateLayout),
+			To:   to.Format(calendarDateLayout),
+			Days: days,
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const toggleCoalesceWindow = 2 * time.Second
+
+type coalescedToggle struct {
+	done      chan struct{}
+	todo      todo
+	err       error
+	expiresAt time.Time
+}
+
+// toggleCoalescer answers repeated toggles carrying the same client operation
+// id with the result of the first one, so a burst of retries from a flaky
+// client flips the todo exactly once. Results are kept for
+// toggleCoalesceWindow after the toggle finished; failed toggles are not
+// kept so the client can retry them.
+type toggleCoalescer struct {
+	mu     sync.Mutex
+	recent map[string]*coalescedToggle
+}
+
+var toggles = &toggleCoalescer{recent: map[string]*coalescedToggle{}}
+
+var errToggleAborted = errors.New("coalesced toggle aborted")
+
+func (coalescer *toggleCoalescer) do(key string, toggle func() (todo, error)) (todo, error) {
+	now := time.Now()
+
+	coalescer.mu.Lock()
+	for recentKey, recent := range coalescer.recent {
+		if !recent.expiresAt.IsZero() && now.After(recent.expiresAt) {
+			delete(coalescer.recent, recentKey)
+		}
+	}
+	if recent, ok := coalescer.recent[key]; ok {
+		coalescer.mu.Unlock()
+		<-recent.done
+		return recent.todo, recent.err
+	}
+	current := &coalescedToggle{done: make(chan struct{}), err: errToggleAborted}
+	coalescer.recent[key] = current
+	coalescer.mu.Unlock()
+
+	// Deferred so that a panicking toggle still releases the duplicates
+	// waiting on it, with errToggleAborted, and can be retried.
+	defer func() {
+		coalescer.mu.Lock()
+		if current.err != nil {
+			delete(coalescer.recent, key)
+		} else {
+			current.expiresAt = time.Now().Add(toggleCoalesceWindow)
+		}
+		coalescer.mu.Unlock()
+		close(current.done)
+	}()
+
+	current.todo, current.err = toggle()
+	return current.todo, current.err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToggleCoalescerReleasesDuplicatesOnPanic(t *testing.T) {
+	coalescer := &toggleCoalescer{recent: map[string]*coalescedToggle{}}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	duplicate := make(chan error)
+
+	go func() {
+		defer func() { recover() }()
+		coalescer.do("key", func() (todo, error) {
+			close(started)
+			<-release
+			panic("toggle failed")
+		})
+	}()
+	<-started
+	go func() {
+		_, err := coalescer.do("key", func() (todo, error) { return todo{}, nil })
+		duplicate <- err
+	}()
+	// Give the duplicate time to start waiting on the toggle. Before the
+	// panic released it, it waited forever.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if err := <-duplicate; !errors.Is(err, errToggleAborted) {
+		t.Errorf("duplicate got %v, want errToggleAborted", err)
+	}
+	if _, err := coalescer.do("key", func() (todo, error) { return todo{ID: 1}, nil }); err != nil {
+		t.Errorf("retry after the panic got %v, want a fresh toggle", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultChangesWait = 30 * time.Second
+	maxChangesWait     = 60 * time.Second
+	changesPollEvery   = time.Second
+)
+
+// checkTodosModified sets Last-Modified for the user's todos and reports
+// whether the request's If-Modified-Since makes the listing unnecessary.
+//
+// HTTP dates have one-second resolution, so Last-Modified is only sent once
+// the second of the last change has passed; otherwise a later change within
+// that same second could be hidden behind a 304. It is not sent either while
+// a timer runs, as tracked_seconds then changes on every request.
+func checkTodosModified(ginContext *gin.Context, todos todoService) (bool, error) {
+	ctx := ginContext.Request.Context()
+	lastModified, now, err := todos.LastModified(ctx, currentUserID(ginContext))
+	if err != nil {
+		return false, err
+	}
+	if running, err := todos.HasRunningTimer(ctx, currentUserID(ginContext)); err != nil || running {
+		return false, err
+	}
+
+	lastModified = lastModified.Truncate(time.Second)
+	if !lastModified.Before(now.Truncate(time.Second)) {
+		return false, nil
+	}
+	ginContext.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(ginContext.GetHeader("If-Modified-Since"))
+	if err != nil {
+		return false, nil
+	}
+	return !lastModified.After(since), nil
+}
+
+type todoChangesResponse struct {
+	LastModified time.Time `json:"last_modified"`
+	todoListResponse
+}
+
+// getTodoChanges long-polls the user's todos. It answers with the page of
+// todos ?page=, ?limit= and the other GET /todos parameters ask for as soon
+// as they change after ?since= (the last_modified of a previous response)
+// and with 204 No Content once ?wait= elapses without a change or the server
+// starts shutting down. The state is
+// polled rather than signalled in process so writes made by other instances
+// are seen as well.
+func getTodoChanges(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		query, err := parseTodoListQuery(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		wait := defaultChangesWait
+		if waitParam := ginContext.Query("wait"); waitParam != "" {
+			var err error
+			wait, err = time.ParseDuration(waitParam)
+			if err != nil || wait < 0 || wait > maxChangesWait {
+				ginContext.Error(newDomainError(errValidation, "wait must be a duration between 0s and 60s"))
+				return
+			}
+		}
+
+		var since time.Time
+		if sinceParam := ginContext.Query("since"); sinceParam != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339Nano, sinceParam)
+			if err != nil {
+				ginContext.Error(newDomainError(errValidation, "since must be an RFC 3339 timestamp"))
+				return
+			}
+		}
+
+		ctx := ginContext.Request.Context()
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+		ticker := time.NewTicker(changesPollEvery)
+		defer ticker.Stop()
+
+		for {
+			lastModified, _, err := todos.LastModified(ctx, currentUserID(ginContext))
+			if err != nil {
+				ginContext.Error(err)
+				return
+			}
+
+			if lastModified.After(since) {
+				changed, err := todos.List(ctx, currentUserID(ginContext), query)
+				if err != nil {
+					ginContext.Error(err)
+					return
+				}
+				ginContext.JSON(http.StatusOK, todoChangesResponse{
+					LastModified:     lastModified,
+					todoListResponse: newTodoListResponse(query, changed),
+				})
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-timeout.C:
+				ginContext.Status(http.StatusNoContent)
+				return
+			case <-shuttingDown.Done():
+				ginContext.Status(http.StatusNoContent)
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckTodosModified(t *testing.T) {
+	lastModified := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	tests := map[string]struct {
+		timerRunning    bool
+		ifModifiedSince time.Time
+		wantNotModified bool
+		wantHeader      bool
+	}{
+		"unchanged":             {ifModifiedSince: lastModified, wantNotModified: true, wantHeader: true},
+		"changed":               {ifModifiedSince: lastModified.Add(-time.Second), wantHeader: true},
+		"unchanged, timer runs": {timerRunning: true, ifModifiedSince: lastModified},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newMemoryTodoRepository()
+			repo.lastModified = lastModified
+			repo.timerRunning = test.timerRunning
+
+			ginContext, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ginContext.Request = httptest.NewRequest(http.MethodGet, "/todos", nil)
+			ginContext.Request.Header.Set("If-Modified-Since", test.ifModifiedSince.Format(http.TimeFormat))
+
+			notModified, err := checkTodosModified(ginContext, newTodoService(repo))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notModified != test.wantNotModified {
+				t.Errorf("got not modified %t, want %t", notModified, test.wantNotModified)
+			}
+			if header := ginContext.Writer.Header().Get("Last-Modified"); (header != "") != test.wantHeader {
+				t.Errorf("got Last-Modified %q, want it sent: %t", header, test.wantHeader)
+			}
+		})
+	}
+}
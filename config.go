@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Every setting is read from an environment variable. CONFIG_FILE may point
+// to a JSON object using the same names as keys, e.g. {"DB_HOST": "db"};
+// environment variables take precedence over the file.
+var configFileValues, configFileErr = loadConfigFile(os.Getenv("CONFIG_FILE"))
+
+func loadConfigFile(path string) (map[string]string, error) {
+	values := map[string]string{}
+	if path == "" {
+		return values, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return values, fmt.Errorf("reading CONFIG_FILE: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return values, fmt.Errorf("parsing CONFIG_FILE %s: %w", path, err)
+	}
+	for key, value := range raw {
+		switch value.(type) {
+		case string, json.Number, bool:
+			values[key] = fmt.Sprint(value)
+		default:
+			return values, fmt.Errorf("CONFIG_FILE %s: %s must be a string, number or boolean", path, key)
+		}
+	}
+	return values, nil
+}
+
+func lookupConfig(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	value, ok := configFileValues[key]
+	return value, ok
+}
+
+func configValue(key string) string {
+	value, _ := lookupConfig(key)
+	return value
+}
+
+func configOrDefault(key, fallback string) string {
+	if value := configValue(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// configBool reads a switch that is off when unset. Values strconv.ParseBool
+// does not accept are an error rather than quietly leaving it off.
+func configBool(key string) (bool, error) {
+	value := configValue(key)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", key, value)
+	}
+	return enabled, nil
+}
+
+type serverConfig struct {
+	DatabaseDSN     string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ListenAddr      string
+	ShutdownTimeout time.Duration
+	GinMode         string
+}
+
+func serverConfigFromEnv() (serverConfig, error) {
+	config := serverConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 5 * time.Minute,
+		ListenAddr:      configOrDefault("LISTEN_ADDR", "localhost:9191"),
+		ShutdownTimeout: 15 * time.Second,
+		GinMode:         configOrDefault("GIN_MODE", gin.DebugMode),
+	}
+	if configFileErr != nil {
+		return config, configFileErr
+	}
+
+	port := configOrDefault("DB_PORT", "3306")
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return config, fmt.Errorf("DB_PORT must be a port number, got %q", port)
+	}
+	database := mysql.NewConfig()
+	database.User = configOrDefault("DB_USER", "admin")
+	database.Passwd = configOrDefault("DB_PASSWORD", "adminpassword")
+	database.Net = "tcp"
+	database.Addr = net.JoinHostPort(configOrDefault("DB_HOST", "localhost"), port)
+	database.DBName = configOrDefault("DB_NAME", "app_db")
+	database.ParseTime = true
+	config.DatabaseDSN = database.FormatDSN()
+
+	var err error
+	if value := configValue("DB_MAX_OPEN_CONNS"); value != "" {
+		if config.MaxOpenConns, err = strconv.Atoi(value); err != nil || config.MaxOpenConns < 1 {
+			return config, fmt.Errorf("DB_MAX_OPEN_CONNS must be a positive integer, got %q", value)
+		}
+	}
+	if value := configValue("DB_MAX_IDLE_CONNS"); value != "" {
+		if config.MaxIdleConns, err = strconv.Atoi(value); err != nil || config.MaxIdleConns < 0 {
+			return config, fmt.Errorf("DB_MAX_IDLE_CONNS must be a non-negative integer, got %q", value)
+		}
+	}
+	if value := configValue("DB_CONN_MAX_LIFETIME"); value != "" {
+		if config.ConnMaxLifetime, err = time.ParseDuration(value); err != nil || config.ConnMaxLifetime < 0 {
+			return config, fmt.Errorf("DB_CONN_MAX_LIFETIME must be a duration such as 5m, got %q", value)
+		}
+	}
+
+	if value := configValue("SHUTDOWN_TIMEOUT"); value != "" {
+		if config.ShutdownTimeout, err = time.ParseDuration(value); err != nil || config.ShutdownTimeout < 0 {
+			return config, fmt.Errorf("SHUTDOWN_TIMEOUT must be a duration such as 15s, got %q", value)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(config.ListenAddr); err != nil {
+		return config, fmt.Errorf("invalid LISTEN_ADDR %q: %w", config.ListenAddr, err)
+	}
+	switch config.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		return config, fmt.Errorf("GIN_MODE must be debug, release or test, got %q", config.GinMode)
+	}
+	return config, nil
+}
+
+// featureSwitches turns optional server behaviour on; each is described
+// where it is used.
+type featureSwitches struct {
+	WarmCaches          bool
+	ReadOnly            bool
+	RequestTransactions bool
+	StrictRESTResponses bool
+}
+
+func featureSwitchesFromEnv() (featureSwitches, error) {
+	var switches featureSwitches
+	var err error
+	if switches.WarmCaches, err = configBool("WARM_CACHES"); err != nil {
+		return switches, err
+	}
+	if switches.ReadOnly, err = configBool("READ_ONLY"); err != nil {
+		return switches, err
+	}
+	if switches.RequestTransactions, err = configBool("REQUEST_TRANSACTIONS"); err != nil {
+		return switches, err
+	}
+	if switches.StrictRESTResponses, err = configBool("STRICT_REST_RESPONSES"); err != nil {
+		return switches, err
+	}
+	return switches, nil
+}
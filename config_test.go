@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestFeatureSwitchesFromEnv(t *testing.T) {
+	t.Setenv("WARM_CACHES", "1")
+	t.Setenv("READ_ONLY", "")
+	t.Setenv("REQUEST_TRANSACTIONS", "TRUE")
+	t.Setenv("STRICT_REST_RESPONSES", "false")
+
+	switches, err := featureSwitchesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := featureSwitches{WarmCaches: true, RequestTransactions: true}
+	if switches != want {
+		t.Errorf("got %+v, want %+v", switches, want)
+	}
+}
+
+func TestFeatureSwitchesFromEnvRejectsInvalidValues(t *testing.T) {
+	for _, key := range []string{"WARM_CACHES", "READ_ONLY", "REQUEST_TRANSACTIONS", "STRICT_REST_RESPONSES"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "yes")
+			if _, err := featureSwitchesFromEnv(); err == nil {
+				t.Errorf("%s=yes was accepted", key)
+			}
+		})
+	}
+}
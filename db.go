@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// errDryRun is returned from a withTx callback to roll back a transaction
+// whose effects were only previewed.
+var errDryRun = errors.New("dry run")
+
+// withTx runs fn inside a transaction. The transaction is committed when fn
+// returns nil and rolled back when it returns an error or panics; the panic
+// is re-raised after the rollback.
+//
+// Inside a request transaction (see requestTransaction) fn runs in a
+// savepoint of that transaction instead, so its errors and dry runs still
+// only undo fn's own work.
+func withTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	if tx, ok := ctx.Value(requestTxKey{}).(*sql.Tx); ok {
+		return withSavepoint(ctx, tx, fn)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			tx.Rollback()
+			panic(recovered)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withSavepoint rolls back to the savepoint even when ctx is cancelled; the
+// request transaction itself is then rolled back by requestTransaction.
+func withSavepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx) error) (err error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT request_step"); err != nil {
+		return err
+	}
+
+	cleanup := context.WithoutCancel(ctx)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			tx.ExecContext(cleanup, "ROLLBACK TO SAVEPOINT request_step")
+			panic(recovered)
+		}
+		if err != nil {
+			tx.ExecContext(cleanup, "ROLLBACK TO SAVEPOINT request_step")
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT request_step")
+	return err
+}
+
+// lockTodo takes a row lock on the user's todo until the transaction ends
+// and returns errTodoNotFound when the user has no such todo outside the
+// trash.
+func lockTodo(ctx context.Context, tx *sql.Tx, userID, id int64) error {
+	err := tx.QueryRowContext(ctx,
+		"SELECT id FROM todos WHERE id = ? AND user_id = ? AND deleted_at IS NULL FOR UPDATE", id, userID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return errTodoNotFound
+	}
+	return err
+}
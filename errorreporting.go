@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	errorReportQueueSize = 64
+	errorReportTimeout   = 5 * time.Second
+)
+
+// Only these request headers are sent along with an error report; everything
+// else (cookies, tokens, API keys) is scrubbed.
+var reportedHeaders = []string{"Accept", "Content-Type", "User-Agent"}
+
+type errorReportingConfig struct {
+	DSN         string
+	Environment string
+	SampleRate  float64
+}
+
+func errorReportingConfigFromEnv() (errorReportingConfig, error) {
+	config := errorReportingConfig{
+		DSN:         configValue("SENTRY_DSN"),
+		Environment: configOrDefault("SENTRY_ENVIRONMENT", "production"),
+		SampleRate:  1,
+	}
+	if value := configValue("SENTRY_SAMPLE_RATE"); value != "" {
+		var err error
+		if config.SampleRate, err = strconv.ParseFloat(value, 64); err != nil || config.SampleRate < 0 || config.SampleRate > 1 {
+			return config, fmt.Errorf("SENTRY_SAMPLE_RATE must be between 0 and 1, got %q", value)
+		}
+	}
+	if config.DSN != "" {
+		if _, _, err := parseSentryDSN(config.DSN); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// parseSentryDSN turns https://<key>@<host>/<project> into the store endpoint
+// and the public key used to authenticate against it.
+func parseSentryDSN(dsn string) (string, string, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.User == nil || parsed.Host == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN")
+	}
+	path := strings.Trim(parsed.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+
+	prefix := ""
+	if slash >= 0 {
+		prefix = "/" + path[:slash]
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/store/", parsed.Scheme, parsed.Host, prefix, project)
+	return endpoint, parsed.User.Username(), nil
+}
+
+type sentryRequest struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Environment string            `json:"environment"`
+	Message     string            `json:"message"`
+	Transaction string            `json:"transaction"`
+	Request     sentryRequest     `json:"request"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+type errorReporter struct {
+	config    errorReportingConfig
+	endpoint  string
+	publicKey string
+	client    *http.Client
+	events    chan sentryEvent
+}
+
+// newErrorReporter returns nil when SENTRY_DSN is unset, which disables
+// error reporting.
+func newErrorReporter(config errorReportingConfig) (*errorReporter, error) {
+	if config.DSN == "" {
+		return nil, nil
+	}
+	endpoint, publicKey, err := parseSentryDSN(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	reporter := &errorReporter{
+		config:    config,
+		endpoint:  endpoint,
+		publicKey: publicKey,
+		client:    &http.Client{Timeout: errorReportTimeout},
+		events:    make(chan sentryEvent, errorReportQueueSize),
+	}
+	go reporter.run()
+	return reporter, nil
+}
+
+func (reporter *errorReporter) run() {
+	for event := range reporter.events {
+		if err := reporter.send(event); err != nil {
+			slog.Warn("error reporting: sending event failed", "event_id", event.EventID, "error", err)
+		}
+	}
+}
+
+func (reporter *errorReporter) send(event sentryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, reporter.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=go-simple-crud-mysql/1.0, sentry_key=%s", reporter.publicKey,
+	))
+
+	response, err := reporter.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+// capture queues an event built from the request, dropping it when sampled
+// out or when the queue is full so reporting never slows requests down.
+func (reporter *errorReporter) capture(ginContext *gin.Context, status int, level, message string, extra map[string]string) {
+	if reporter.config.SampleRate < 1 && rand.Float64() >= reporter.config.SampleRate {
+		return
+	}
+
+	route := ginContext.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	event := sentryEvent{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       level,
+		Platform:    "go",
+		Environment: reporter.config.Environment,
+		Message:     message,
+		Transaction: ginContext.Request.Method + " " + route,
+		Request:     scrubRequest(ginContext.Request),
+		Tags: map[string]string{
+			"status":     strconv.Itoa(status),
+			"route":      route,
+			"request_id": requestID(ginContext.Request.Context()),
+		},
+		Extra: extra,
+	}
+
+	select {
+	case reporter.events <- event:
+	default:
+	}
+}
+
+// scrubRequest keeps the shape of the request without personal data: query
+// parameter values, client addresses, bodies and most headers are dropped.
+func scrubRequest(request *http.Request) sentryRequest {
+	query := request.URL.Query()
+	for key := range query {
+		query[key] = []string{"[filtered]"}
+	}
+
+	headers := map[string]string{}
+	for _, name := range reportedHeaders {
+		if value := request.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+
+	return sentryRequest{
+		Method:      request.Method,
+		URL:         request.URL.Path,
+		QueryString: query.Encode(),
+		Headers:     headers,
+	}
+}
+
+func newEventID() string {
+	id := make([]byte, 16)
+	cryptorand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// reportErrors captures panics and 5xx responses. It must be registered after
+// gin.Recovery: panics are re-raised so Recovery still writes the 500.
+func reportErrors(reporter *errorReporter) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		if reporter == nil {
+			ginContext.Next()
+			return
+		}
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				reporter.capture(ginContext, http.StatusInternalServerError, "fatal", fmt.Sprintf("panic: %v", recovered), map[string]string{
+					"stacktrace": string(debug.Stack()),
+				})
+				panic(recovered)
+			}
+		}()
+
+		ginContext.Next()
+
+		if rejectedAsReadOnly(ginContext) {
+			return
+		}
+		if status := ginContext.Writer.Status(); status >= http.StatusInternalServerError {
+			message := fmt.Sprintf("%d %s", status, http.StatusText(status))
+			if len(ginContext.Errors) > 0 {
+				message += " (" + errorSummary(ginContext, ginContext.Errors.Last().Err) + ")"
+			}
+			reporter.capture(ginContext, status, "error", message, nil)
+		}
+	}
+}
+
+// errorSummary describes err by its code and, for internal errors, the type
+// of its innermost cause. Error messages can carry queries, addresses and
+// user input, so they stay in the access log and are never reported.
+func errorSummary(ginContext *gin.Context, err error) string {
+	_, body := errorBody(ginContext, err)
+	if body.Code != internalErrorCode {
+		return body.Code
+	}
+	for {
+		unwrapped := errors.Unwrap(err)
+		if unwrapped == nil {
+			return fmt.Sprintf("%s, %T", body.Code, err)
+		}
+		err = unwrapped
+	}
+}
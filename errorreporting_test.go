@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestReportErrorsLeavesOutErrorMessages(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want string
+	}{
+		"internal": {
+			err:  fmt.Errorf("saving todo: %w", &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout on jane@example.com"}),
+			want: "500 Internal Server Error (internal, *mysql.MySQLError)",
+		},
+		"unavailable": {
+			err:  newDomainError(errUnavailable, "replica 10.0.0.3 is lagging"),
+			want: "503 Service Unavailable (unavailable)",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reporter := &errorReporter{config: errorReportingConfig{SampleRate: 1}, events: make(chan sentryEvent, 1)}
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(reportErrors(reporter), mapErrors)
+			router.GET("/fail", func(ginContext *gin.Context) { ginContext.Error(test.err) })
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+			event := <-reporter.events
+			if event.Message != test.want {
+				t.Errorf("got message %q, want %q", event.Message, test.want)
+			}
+			if strings.Contains(event.Message, test.err.Error()) {
+				t.Errorf("the message %q carries the error text", event.Message)
+			}
+		})
+	}
+}
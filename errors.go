@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Handlers report failures with ginContext.Error and return; mapErrors turns
+// the error into the response. Errors of one of these kinds are answered
+// with the matching status, code and their own message, anything else is a
+// 500 whose details stay in the logs.
+var (
+	errNotFound     = errors.New("not found")
+	errConflict     = errors.New("conflict")
+	errValidation   = errors.New("validation failed")
+	errUnauthorized = errors.New("unauthorized")
+	errUnavailable  = errors.New("unavailable")
+	errReadOnlyMode = errors.New("read-only mode")
+)
+
+// statusClientClosedRequest marks requests whose client went away before the
+// response was ready; they are not server errors and are not reported.
+const statusClientClosedRequest = 499
+
+type errorKind struct {
+	kind   error
+	status int
+	code   string
+}
+
+// errorKinds gives every kind its status and the stable code clients can
+// match on instead of the message.
+var errorKinds = []errorKind{
+	{errValidation, http.StatusBadRequest, "validation_failed"},
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{errNotFound, http.StatusNotFound, "not_found"},
+	{errConflict, http.StatusConflict, "conflict"},
+	{errUnavailable, http.StatusServiceUnavailable, "unavailable"},
+	{errReadOnlyMode, http.StatusServiceUnavailable, "read_only"},
+	{context.Canceled, statusClientClosedRequest, "client_closed_request"},
+}
+
+const internalErrorCode = "internal"
+
+type domainError struct {
+	kind    error
+	message string
+	details any
+}
+
+func newDomainError(kind error, message string) error {
+	return &domainError{kind: kind, message: message}
+}
+
+func (err *domainError) Error() string {
+	return err.message
+}
+
+func (err *domainError) Unwrap() error {
+	return err.kind
+}
+
+var (
+	errTodoNotFound   = newDomainError(errNotFound, "todo not found")
+	errTodoNotInTrash = newDomainError(errNotFound, "todo not found in trash")
+	errRouteNotFound  = newDomainError(errNotFound, "no such endpoint")
+	errInvalidAPIKey  = newDomainError(errUnauthorized, "invalid API key")
+)
+
+// fieldError is one failed rule of a request body, with the field named as
+// in the JSON ("todos[0].item").
+type fieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// validationError turns a binding error into an errValidation error listing
+// the failed fields, without the Go types the decoder mentions.
+func validationError(err error) error {
+	return invalidInput("invalid request body", err)
+}
+
+// invalidInput is validationError with its own message, for input that is
+// validated after binding.
+func invalidInput(message string, err error) error {
+	var validationErrors validator.ValidationErrors
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrors):
+		details := make([]fieldError, 0, len(validationErrors))
+		for _, failed := range validationErrors {
+			_, field, _ := strings.Cut(failed.Namespace(), ".")
+			details = append(details, fieldError{Field: field, Rule: failed.ActualTag(), Param: failed.Param()})
+		}
+		return &domainError{kind: errValidation, message: message, details: details}
+	case errors.As(err, &typeError):
+		return &domainError{kind: errValidation, message: message, details: []fieldError{
+			{Field: typeError.Field, Rule: "type", Param: typeError.Value},
+		}}
+	}
+	return newDomainError(errValidation, "request body is not valid JSON")
+}
+
+// useJSONFieldNames makes validation errors name fields by their JSON name.
+func useJSONFieldNames() {
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// errorResponse is the JSON body of every error response. It carries the
+// request id so a client report can be matched with the server's logs.
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id"`
+}
+
+func errorBody(ginContext *gin.Context, err error) (int, errorResponse) {
+	response := errorResponse{
+		Code:      internalErrorCode,
+		Message:   "internal server error",
+		RequestID: requestID(ginContext.Request.Context()),
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.kind) {
+			response.Code, response.Message = kind.code, err.Error()
+			var domainErr *domainError
+			if errors.As(err, &domainErr) {
+				response.Details = domainErr.details
+			}
+			return kind.status, response
+		}
+	}
+	return http.StatusInternalServerError, response
+}
+
+// mapErrors answers with the last error a handler reported, unless the
+// handler already started writing its response.
+func mapErrors(ginContext *gin.Context) {
+	ginContext.Next()
+
+	if len(ginContext.Errors) == 0 || ginContext.Writer.Written() {
+		return
+	}
+	ginContext.JSON(errorBody(ginContext, ginContext.Errors.Last().Err))
+}
+
+// respondToPanic is the gin recovery handler, so a panic is answered like
+// any other internal error.
+func respondToPanic(ginContext *gin.Context, _ any) {
+	ginContext.AbortWithStatusJSON(errorBody(ginContext, errors.New("panic")))
+}
+
+func notFound(ginContext *gin.Context) {
+	ginContext.Error(errRouteNotFound)
+}
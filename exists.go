@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type todosExistPayload struct {
+	IDs []int64 `json:"ids" binding:"required,min=1,max=1000,dive,min=1"`
+}
+
+type todosExistResponse struct {
+	Existing []int64 `json:"existing"`
+	Missing  []int64 `json:"missing"`
+}
+
+func checkTodosExist(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload todosExistPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		found, err := todos.Existing(ginContext.Request.Context(), currentUserID(ginContext), payload.IDs)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		var existing, missing = []int64{}, []int64{}
+		seen := map[int64]bool{}
+		for _, id := range payload.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if found[id] {
+				existing = append(existing, id)
+			} else {
+				missing = append(missing, id)
+			}
+		}
+
+		ginContext.JSON(http.StatusOK, todosExistResponse{Existing: existing, Missing: missing})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const feedEntriesLimit = 50
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Content string   `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+var errInvalidFeedToken = newDomainError(errUnauthorized, "invalid feed token")
+
+// todoEvent is a todo being added or completed.
+type todoEvent struct {
+	Kind       string
+	TodoID     int
+	Item       string
+	HappenedAt time.Time
+}
+
+// getTodosFeed serves the feed of the user whose feed token is passed as
+// ?token=, since feed readers cannot send headers.
+func getTodosFeed(users userService, todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		ctx := ginContext.Request.Context()
+		userID, err := users.UserBySecret(ctx, feedTokenColumn, ginContext.Query("token"))
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+		if userID == 0 {
+			ginContext.Error(errInvalidFeedToken)
+			return
+		}
+
+		events, err := todos.Events(ctx, userID, feedEntriesLimit)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		scheme := "http"
+		if ginContext.Request.TLS != nil {
+			scheme = "https"
+		}
+		baseURL := scheme + "://" + ginContext.Request.Host
+
+		feed := atomFeed{
+			ID:      fmt.Sprintf("urn:go-simple-crud-mysql:user:%d:todos", userID),
+			Title:   "Todos",
+			Updated: time.Now().UTC().Format(time.RFC3339),
+			Author:  "go-simple-crud-mysql",
+			Link:    atomLink{Href: baseURL + ginContext.Request.URL.Path, Rel: "self"},
+		}
+		for _, event := range events {
+			if len(feed.Entries) == 0 {
+				feed.Updated = event.HappenedAt.Format(time.RFC3339)
+			}
+			title := "Added: " + event.Item
+			if event.Kind == "completed" {
+				title = "Completed: " + event.Item
+			}
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:      fmt.Sprintf("urn:go-simple-crud-mysql:todo:%d:%s:%d", event.TodoID, event.Kind, event.HappenedAt.Unix()),
+				Title:   title,
+				Updated: event.HappenedAt.Format(time.RFC3339),
+				Link:    atomLink{Href: fmt.Sprintf("%s/todos/%d", baseURL, event.TodoID)},
+				Content: event.Item,
+			})
+		}
+
+		body, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+		ginContext.Data(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...))
+	}
+}
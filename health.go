@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+type poolState struct {
+	MaxOpen        int   `json:"max_open"`
+	Open           int   `json:"open"`
+	InUse          int   `json:"in_use"`
+	Idle           int   `json:"idle"`
+	WaitCount      int64 `json:"wait_count"`
+	WaitDurationMS int64 `json:"wait_duration_ms"`
+}
+
+type readiness struct {
+	Status   string    `json:"status"`
+	Detail   string    `json:"detail,omitempty"`
+	ReadOnly bool      `json:"read_only"`
+	Pool     poolState `json:"pool"`
+}
+
+// getHealthz is the liveness probe: it answers as long as the process can
+// serve HTTP and never touches the database.
+func getHealthz(ginContext *gin.Context) {
+	ginContext.JSON(http.StatusOK, gin.H{"status": checkOK})
+}
+
+// getReadyz is the readiness probe. It fails with 503 when MySQL does not
+// answer a ping within readinessCheckTimeout and once shutdown has started,
+// so the instance is taken out of rotation before it stops.
+func getReadyz(ginContext *gin.Context) {
+	stats := db.Stats()
+	report := readiness{
+		Status:   checkOK,
+		ReadOnly: readOnly.Load(),
+		Pool: poolState{
+			MaxOpen:        stats.MaxOpenConnections,
+			Open:           stats.OpenConnections,
+			InUse:          stats.InUse,
+			Idle:           stats.Idle,
+			WaitCount:      stats.WaitCount,
+			WaitDurationMS: stats.WaitDuration.Milliseconds(),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ginContext.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+	if shuttingDown.Err() != nil {
+		report.Status, report.Detail = checkFail, "shutting down"
+	} else if err := db.PingContext(ctx); err != nil {
+		slog.ErrorContext(ctx, "readiness: pinging MySQL failed", "error", err)
+		report.Status, report.Detail = checkFail, "cannot reach MySQL"
+	}
+
+	status := http.StatusOK
+	if report.Status == checkFail {
+		status = http.StatusServiceUnavailable
+	}
+	ginContext.JSON(status, report)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type heatmapDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type heatmapResponse struct {
+	Year  int          `json:"year"`
+	Total int          `json:"total"`
+	Days  []heatmapDay `json:"days"`
+}
+
+type heatmapCacheEntry struct {
+	days      []heatmapDay
+	expiresAt time.Time
+}
+
+// heatmapCacheLimit caps the entries of a heatmapCache; one is kept per user
+// and year asked for.
+const heatmapCacheLimit = 10000
+
+// heatmapCache holds each user's completions per day up to the start of the
+// current UTC day. Entries expire at midnight and are dropped when the user
+// changes a todo; today's completions are always read live.
+type heatmapCache struct {
+	mu      sync.Mutex
+	entries map[int64]map[int]heatmapCacheEntry
+	size    int
+	// generation counts invalidations, so a query that was running while
+	// the user's todos changed does not cache its result.
+	generation uint64
+}
+
+func newHeatmapCache() *heatmapCache {
+	return &heatmapCache{entries: map[int64]map[int]heatmapCacheEntry{}}
+}
+
+var heatmapFlights flightGroup[[]heatmapDay]
+
+// completionsBefore shares the query between concurrent callers and detaches
+// it from ctx's cancellation, like todoService.All.
+func (cache *heatmapCache) completionsBefore(ctx context.Context, repo todoRepository, userID int64, year int, today time.Time) ([]heatmapDay, error) {
+	now := time.Now()
+	cache.mu.Lock()
+	entry, ok := cache.entries[userID][year]
+	if ok && !now.Before(entry.expiresAt) {
+		cache.delete(userID, year)
+		ok = false
+	}
+	generation := cache.generation
+	cache.mu.Unlock()
+	if ok {
+		return entry.days, nil
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	until := from.AddDate(1, 0, 0)
+	if today.Before(until) {
+		until = today
+	}
+
+	flightKey := fmt.Sprintf("%d/%d/%s/%d", userID, year, until.Format(calendarDateLayout), generation)
+	days, err := heatmapFlights.do(flightKey, func() ([]heatmapDay, error) {
+		return repo.CompletionsPerDay(context.WithoutCancel(ctx), userID, from, until)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.generation != generation {
+		return days, nil
+	}
+	if cache.size >= heatmapCacheLimit {
+		cache.deleteExpired(now)
+	}
+	if cache.size >= heatmapCacheLimit {
+		// Still full of live entries: make room by dropping an arbitrary
+		// user's.
+		for evicted := range cache.entries {
+			cache.forgetLocked(evicted)
+			break
+		}
+	}
+	if cache.entries[userID] == nil {
+		cache.entries[userID] = map[int]heatmapCacheEntry{}
+	}
+	if _, replaced := cache.entries[userID][year]; !replaced {
+		cache.size++
+	}
+	cache.entries[userID][year] = heatmapCacheEntry{days: days, expiresAt: today.AddDate(0, 0, 1)}
+	return days, nil
+}
+
+// forget drops the user's entries, after their completions may have changed.
+func (cache *heatmapCache) forget(userID int64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.generation++
+	cache.forgetLocked(userID)
+}
+
+// forgetAll drops every entry, after a restore replaced all todos.
+func (cache *heatmapCache) forgetAll() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.generation++
+	cache.entries = map[int64]map[int]heatmapCacheEntry{}
+	cache.size = 0
+}
+
+// The methods below must be called with cache.mu held.
+
+func (cache *heatmapCache) forgetLocked(userID int64) {
+	cache.size -= len(cache.entries[userID])
+	delete(cache.entries, userID)
+}
+
+func (cache *heatmapCache) delete(userID int64, year int) {
+	delete(cache.entries[userID], year)
+	cache.size--
+	if len(cache.entries[userID]) == 0 {
+		delete(cache.entries, userID)
+	}
+}
+
+func (cache *heatmapCache) deleteExpired(now time.Time) {
+	for userID, years := range cache.entries {
+		for year, entry := range years {
+			if !now.Before(entry.expiresAt) {
+				cache.delete(userID, year)
+			}
+		}
+	}
+}
+
+func getHeatmap(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+
+		year := today.Year()
+		if yearParam := ginContext.Query("year"); yearParam != "" {
+			var err error
+			year, err = strconv.Atoi(yearParam)
+			if err != nil || year < 1970 || year > today.Year() {
+				ginContext.Error(newDomainError(errValidation, "invalid year"))
+				return
+			}
+		}
+
+		days, err := todos.Heatmap(ginContext.Request.Context(), currentUserID(ginContext), year, today)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		total := 0
+		for _, day := range days {
+			total += day.Count
+		}
+
+		ginContext.JSON(http.StatusOK, heatmapResponse{Year: year, Total: total, Days: days})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fillHeatmapCache adds heatmapCacheLimit entries expiring at expiresAt for
+// users other than 1.
+func fillHeatmapCache(cache *heatmapCache, expiresAt time.Time) {
+	for userID := int64(2); cache.size < heatmapCacheLimit; userID++ {
+		cache.entries[userID] = map[int]heatmapCacheEntry{2024: {expiresAt: expiresAt}}
+		cache.size++
+	}
+}
+
+func TestHeatmapCacheStaysWithinLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryTodoRepository()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	expired := newHeatmapCache()
+	fillHeatmapCache(expired, today)
+	if _, err := expired.completionsBefore(ctx, repo, 1, today.Year(), today); err != nil {
+		t.Fatal(err)
+	}
+	if expired.size != 1 || len(expired.entries) != 1 {
+		t.Errorf("got %d entries, want only the new one", expired.size)
+	}
+
+	live := newHeatmapCache()
+	fillHeatmapCache(live, today.AddDate(0, 0, 1))
+	if _, err := live.completionsBefore(ctx, repo, 1, today.Year(), today); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := live.entries[1][today.Year()]; live.size != heatmapCacheLimit || !ok {
+		t.Errorf("got %d entries, want %d including the new one", live.size, heatmapCacheLimit)
+	}
+}
+
+func TestHeatmapCacheDropsExpiredEntryOnLookup(t *testing.T) {
+	cache := newHeatmapCache()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	cache.entries[1] = map[int]heatmapCacheEntry{today.Year(): {expiresAt: today}}
+	cache.size = 1
+
+	repo := newMemoryTodoRepository()
+	if _, err := cache.completionsBefore(context.Background(), repo, 1, today.Year(), today); err != nil {
+		t.Fatal(err)
+	}
+	if calls := repo.called("CompletionsPerDay"); calls != 1 || cache.size != 1 {
+		t.Errorf("got %d queries and %d entries, want the expired entry replaced", calls, cache.size)
+	}
+}
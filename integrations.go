@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Each user can issue a feed token for their Atom feed and an API key for
+// the Zapier endpoints. Only their SHA-256 hashes are stored; a secret is
+// shown once, when it is issued, and issuing it again replaces it.
+const (
+	feedTokenColumn = "feed_token_hash"
+	apiKeyColumn    = "api_key_hash"
+)
+
+func newIntegrationSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(secret)
+}
+
+func hashIntegrationSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func issueFeedToken(users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		token, err := users.IssueSecret(ginContext.Request.Context(), currentUserID(ginContext), feedTokenColumn)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, gin.H{"token": token, "feed_url": "/feeds/todos.atom?token=" + token})
+	}
+}
+
+func revokeFeedToken(users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		if err := users.RevokeSecret(ginContext.Request.Context(), currentUserID(ginContext), feedTokenColumn); err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.Status(http.StatusNoContent)
+	}
+}
+
+func issueAPIKey(users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		key, err := users.IssueSecret(ginContext.Request.Context(), currentUserID(ginContext), apiKeyColumn)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, gin.H{"api_key": key})
+	}
+}
+
+func revokeAPIKey(users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		if err := users.RevokeSecret(ginContext.Request.Context(), currentUserID(ginContext), apiKeyColumn); err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method"`
+}
+
+// todoLinkHandlers names the function building the handler behind each link
+// relation; the paths are looked up in the router so links follow any route
+// changes.
+var todoLinkHandlers = map[string]any{
+	"self":   getTodo,
+	"toggle": toggleTodoStatus,
+	"delete": deleteTodo,
+	"list":   getTodos,
+}
+
+// trashedTodoLinkHandlers replace todoLinkHandlers for todos in the trash,
+// which can only be restored or purged.
+var trashedTodoLinkHandlers = map[string]any{
+	"restore": restoreTodo,
+	"purge":   purgeTodo,
+	"trash":   getTrash,
+}
+
+// todoLinkTemplate is a route path split around its ":id" parameter, so
+// building a link is a single concatenation per todo.
+type todoLinkTemplate struct {
+	rel    string
+	prefix string
+	suffix string
+	hasID  bool
+	method string
+}
+
+var todoLinkTemplates, trashedTodoLinkTemplates []todoLinkTemplate
+
+func handlerName(handler any) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
+
+// registerTodoLinks must run after all routes are registered and before the
+// server starts handling requests.
+func registerTodoLinks(routes gin.RoutesInfo) {
+	todoLinkTemplates = linkTemplates(todoLinkHandlers, routes)
+	trashedTodoLinkTemplates = linkTemplates(trashedTodoLinkHandlers, routes)
+}
+
+func linkTemplates(handlers map[string]any, routes gin.RoutesInfo) []todoLinkTemplate {
+	var templates []todoLinkTemplate
+	for rel, handler := range handlers {
+		// Routes name the closure the function returned, such as
+		// "main.getTodo.func1".
+		name := handlerName(handler) + ".func"
+		for _, route := range routes {
+			if strings.HasPrefix(route.Handler, name) {
+				prefix, suffix, hasID := strings.Cut(route.Path, ":id")
+				templates = append(templates, todoLinkTemplate{
+					rel:    rel,
+					prefix: prefix,
+					suffix: suffix,
+					hasID:  hasID,
+					method: route.Method,
+				})
+				break
+			}
+		}
+	}
+	return templates
+}
+
+func linksForTodo(id int, trashed bool) map[string]link {
+	templates := todoLinkTemplates
+	if trashed {
+		templates = trashedTodoLinkTemplates
+	}
+	links := make(map[string]link, len(templates))
+	idString := strconv.Itoa(id)
+	for _, template := range templates {
+		href := template.prefix
+		if template.hasID {
+			href = template.prefix + idString + template.suffix
+		}
+		links[template.rel] = link{Href: href, Method: template.method}
+	}
+	return links
+}
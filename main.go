@@ -1,234 +1,519 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	_ "github.com/go-sql-driver/mysql"
 )
 
 var (
-	db       *sql.DB
+	db *sql.DB
 )
 
 type todo struct {
-	ID        int    `json:"id"`
-	Item      string `json:"item"`
-	Completed bool   `json:"completed"`
+	ID              int        `json:"id"`
+	Item            string     `json:"item"`
+	Completed       bool       `json:"completed"`
+	EstimateMinutes *int       `json:"estimate_minutes"`
+	DueDate         *time.Time `json:"due_date"`
+	Priority        *string    `json:"priority"`
+	Tags            []string   `json:"tags"`
+	TrackedSeconds  int64      `json:"tracked_seconds"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+
+	Links map[string]link `json:"_links"`
 }
 
-
-func parseValidationError(err error) string {
-	if validationErrors, ok := err.(validator.ValidationErrors); ok {
-		var result string
-		for _, fieldError := range validationErrors {
-			result += fmt.Sprintf(
-				"Field validation for '%s' failed: '%s' (condition: %s)\n",
-				fieldError.Field(),
-				fieldError.ActualTag(),
-				fieldError.Param(),
-			)
-		}
-		return result
+func parseDryRun(ginContext *gin.Context) (bool, error) {
+	dryRunParam := ginContext.Query("dry_run")
+	if dryRunParam == "" {
+		return false, nil
 	}
-	return "an unknown validation error occurred"
+	dryRun, err := strconv.ParseBool(dryRunParam)
+	if err != nil {
+		return false, newDomainError(errValidation, "invalid dry_run value")
+	}
+	return dryRun, nil
 }
 
 func parseIDParam(ginContext *gin.Context) (int64, error) {
 	idParam := ginContext.Param("id")
 	id, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("invalid id format")
+		return 0, newDomainError(errValidation, "invalid id format")
 	}
 	return id, nil
 }
 
 type todoPayload struct {
-	Item      string `json:"item" binding:"required,max=100,min=2"`
-	Completed bool   `json:"completed"`
+	Item            string     `json:"item" binding:"required,max=100,min=2"`
+	Completed       bool       `json:"completed"`
+	EstimateMinutes *int       `json:"estimate_minutes" binding:"omitempty,min=1"`
+	DueDate         *time.Time `json:"due_date"`
+	Priority        *string    `json:"priority" binding:"omitempty,oneof=low medium high"`
+	Tags            []string   `json:"tags" binding:"max=20,dive,min=1,max=50,excludesall=0x2C"`
 }
 
-func createTodo(ginContext *gin.Context) {
-	var payload todoPayload
-
-	if err := ginContext.ShouldBindJSON(&payload); err != nil {
-		ginContext.JSON(http.StatusBadRequest, gin.H{"error": parseValidationError(err)})
-		return
+// dueDate is the payload's due date in UTC, as DATETIME columns have no time
+// zone.
+func (payload todoPayload) dueDate() *time.Time {
+	if payload.DueDate == nil {
+		return nil
 	}
+	dueDate := payload.DueDate.UTC().Truncate(time.Second)
+	return &dueDate
+}
 
-	result, err := db.Exec("INSERT INTO todos (item, completed) VALUES (?, ?)", payload.Item, payload.Completed)
-	if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+func createTodo(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		dryRun, err := parseDryRun(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		var payload todoPayload
+
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		createdTodo, err := todos.Create(ginContext.Request.Context(), currentUserID(ginContext), payload, dryRun)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		if dryRun {
+			ginContext.JSON(http.StatusOK, createdTodo)
+			return
+		}
+
+		respondCreated(ginContext, createdTodo.Links["self"].Href, createdTodo)
 	}
+}
 
-	id, _ := result.LastInsertId()
-	ginContext.JSON(http.StatusCreated, gin.H{"id": id, "item": payload.Item, "completed": payload.Completed})
+// todoListResponse is the envelope of GET /todos. Pages after the first are
+// streamed in the same shape by getTodos.
+type todoListResponse struct {
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	TotalPages int    `json:"total_pages"`
+	Todos      []todo `json:"todos"`
 }
 
-func getTodos(ginContext *gin.Context) {
-rows, err := db.Query("SELECT id, item, completed FROM todos")
-	if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+func newTodoListResponse(query todoListQuery, list todoList) todoListResponse {
+	return todoListResponse{
+		Page:       query.page,
+		Limit:      query.limit,
+		Total:      list.total,
+		TotalPages: query.totalPages(list.total),
+		Todos:      list.todos,
 	}
-	defer rows.Close()
+}
+
+func getTodos(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		query, err := parseTodoListQuery(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		if notModified, err := checkTodosModified(ginContext, todos); err != nil {
+			ginContext.Error(err)
+			return
+		} else if notModified {
+			ginContext.Status(http.StatusNotModified)
+			return
+		}
+
+		// Clients polling the list mostly ask for the first page, so it is
+		// loaded once for concurrent identical requests instead of streamed.
+		if query.page == 1 {
+			list, err := todos.List(ginContext.Request.Context(), currentUserID(ginContext), query)
+			if err != nil {
+				ginContext.Error(err)
+				return
+			}
+			ginContext.JSON(http.StatusOK, newTodoListResponse(query, list))
+			return
+		}
 
-	var todos = []todo{}
-	for rows.Next() {
-		var t todo
-		if err := rows.Scan(&t.ID, &t.Item, &t.Completed); err != nil {
-			ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		page, err := todos.Page(ginContext.Request.Context(), currentUserID(ginContext), query)
+		if err != nil {
+			ginContext.Error(err)
 			return
 		}
-		todos = append(todos, t)
+
+		ginContext.Header("Content-Type", "application/json; charset=utf-8")
+		ginContext.Status(http.StatusOK)
+		fmt.Fprintf(ginContext.Writer, `{"page":%d,"limit":%d,"total":%d,"total_pages":%d,"todos":`,
+			query.page, query.limit, page.total, query.totalPages(page.total))
+		if streamTodos(ginContext, todos, page) {
+			ginContext.Writer.WriteString("}")
+		}
 	}
+}
+
+// todoEncoder encodes one todo at a time into a reusable buffer. Encoders
+// are pooled across requests so streaming a page does not allocate a new
+// encoder and grow a new buffer each time.
+type todoEncoder struct {
+	buffer  bytes.Buffer
+	encoder *json.Encoder
+}
 
-	ginContext.JSON(http.StatusOK, todos)
+var todoEncoders = sync.Pool{
+	New: func() any {
+		e := &todoEncoder{}
+		e.encoder = json.NewEncoder(&e.buffer)
+		return e
+	},
 }
 
-func getTodo(ginContext *gin.Context) {
-	id, err := parseIDParam(ginContext)
+// streamTodos writes the todos as a JSON array while they are scanned, so
+// memory stays flat however long the list is. Once the status is sent an
+// error can only be reported by cutting the array short, which leaves the
+// body invalid JSON for the client to notice; it returns false in that case.
+func streamTodos(ginContext *gin.Context, todos todoService, page todoPage) bool {
+	writer := ginContext.Writer
+	e := todoEncoders.Get().(*todoEncoder)
+	defer todoEncoders.Put(e)
+
+	writer.WriteString("[")
+	count := 0
+	err := todos.Each(ginContext.Request.Context(), page, func(t todo) error {
+		e.buffer.Reset()
+		if count > 0 {
+			e.buffer.WriteByte(',')
+		}
+		if err := e.encoder.Encode(t); err != nil {
+			return err
+		}
+		if _, err := writer.Write(e.buffer.Bytes()); err != nil {
+			return err
+		}
+		if count == 0 {
+			writer.Flush()
+		}
+		count++
+		return nil
+	})
 	if err != nil {
-		ginContext.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		ginContext.Error(err)
+		return false
 	}
+	writer.WriteString("]")
+	return true
+}
 
-	var todo todo
-	err = db.QueryRow("SELECT id, item, completed FROM todos WHERE id = ?", id).Scan(
-		&todo.ID, &todo.Item, &todo.Completed,
-	)
+func getTodo(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
 
-	if err == sql.ErrNoRows {
-		ginContext.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
-		return
-	} else if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		todo, err := todos.Get(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, todo)
 	}
+}
 
-	ginContext.JSON(http.StatusOK, todo)
+func toggleTodoStatus(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		toggled, err := todos.Toggle(ginContext.Request.Context(), currentUserID(ginContext), id, ginContext.GetHeader("X-Client-Op-ID"))
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, toggled)
+	}
 }
 
-func toggleTodoStatus(ginContext *gin.Context) {
-	id, err := parseIDParam(ginContext)
-	if err != nil {
-		ginContext.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func updateTodo(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		dryRun, err := parseDryRun(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		var payload todoPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		updatedTodo, err := todos.Update(ginContext.Request.Context(), currentUserID(ginContext), id, payload, dryRun)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, updatedTodo)
 	}
+}
 
-	var todo todo
-	err = db.QueryRow("SELECT id, item, completed FROM todos WHERE id = ?", id).Scan(
-		&todo.ID, &todo.Item, &todo.Completed,
-	)
+func deleteTodo(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
 
-	if err == sql.ErrNoRows {
-		ginContext.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
-		return
-	} else if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		deletedTodo, err := todos.Delete(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		respondDeleted(ginContext, deletedTodo)
 	}
+}
 
-	newStatus := !todo.Completed
-	_, err = db.Exec("UPDATE todos SET completed = ? WHERE id = ?", newStatus, id)
-	if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+func getTrash(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		trashed, err := todos.Trash(ginContext.Request.Context(), currentUserID(ginContext))
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, trashed)
 	}
+}
+
+func restoreTodo(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
 
-	ginContext.JSON(http.StatusOK, gin.H{"id": todo.ID, "item": todo.Item, "completed": newStatus})
+		restored, err := todos.Restore(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, restored)
+	}
 }
 
-func updateTodo(ginContext *gin.Context) {
-	id, err := parseIDParam(ginContext)
-	if err != nil {
-		ginContext.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func purgeTodo(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		purged, err := todos.Purge(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		respondDeleted(ginContext, purged)
 	}
+}
 
-	var payload todoPayload
-	if err := ginContext.ShouldBindJSON(&payload); err != nil {
-		ginContext.JSON(http.StatusBadRequest, gin.H{"error": parseValidationError(err)})
-		return
+// runCommand runs a CLI command; interrupting it cancels its queries, so an
+// aborted restore is rolled back instead of being left half applied.
+func runCommand(name string, args []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	todos := newTodoService(mysqlTodoRepository{})
+	switch name {
+	case "backup":
+		return runBackup(ctx, todos, args)
+	case "restore":
+		return runRestore(ctx, todos, args)
 	}
+	return fmt.Errorf("unknown command %q", name)
+}
 
-	result, err := db.Exec("UPDATE todos SET item = ?, completed = ? WHERE id = ?", payload.Item, payload.Completed, id)
-	if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+func main() {
+	// Application logs are JSON lines on stderr; requests are logged by
+	// accessLog.
+	slog.SetDefault(slog.New(requestIDHandler{slog.NewJSONHandler(os.Stderr, nil)}))
+
+	report := runStartupChecks()
+	json.NewEncoder(os.Stdout).Encode(report)
+	if report.Status == checkFail {
+		os.Exit(1)
 	}
+	defer db.Close()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		ginContext.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	ginContext.JSON(http.StatusOK, gin.H{"id": id, "item": payload.Item, "completed": payload.Completed})
-}
+	serverConfig, _ := serverConfigFromEnv()
+	gin.SetMode(serverConfig.GinMode)
+	switches, _ := featureSwitchesFromEnv()
+	strictRESTResponses = switches.StrictRESTResponses
+	readOnly.Store(switches.ReadOnly)
 
-func deleteTodo(ginContext *gin.Context) {
-	id, err := parseIDParam(ginContext)
-	if err != nil {
-		ginContext.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+	todoSvc := newTodoService(mysqlTodoRepository{})
+	userSvc := userService{repo: mysqlUserRepository{}}
+	pomodoros := newPomodoroHub(todoSvc)
 
-	var deletedTodo todo
-	err = db.QueryRow("SELECT id, item, completed FROM todos WHERE id = ?", id).Scan(
-		&deletedTodo.ID, &deletedTodo.Item, &deletedTodo.Completed,
-	)
-	if err == sql.ErrNoRows {
-		ginContext.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
-		return
-	} else if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if switches.WarmCaches {
+		go primeCaches(shuttingDown, todoSvc)
 	}
 
-	_, err = db.Exec("DELETE FROM todos WHERE id = ?", id)
+	accessLogConfig, _ := accessLogConfigFromEnv()
+	accessLogger, err := accessLog(accessLogConfig)
 	if err != nil {
-		ginContext.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		slog.Error("opening access log", "error", err)
+		os.Exit(1)
 	}
 
-	ginContext.IndentedJSON(http.StatusOK, deletedTodo)
-}
-
-func main() {
-	var err error
-	db, err = sql.Open("mysql", "admin:adminpassword@tcp(localhost:3306)/app_db")
+	errorReportingConfig, _ := errorReportingConfigFromEnv()
+	reporter, err := newErrorReporter(errorReportingConfig)
 	if err != nil {
-		panic(err)
+		slog.Error("configuring error reporting", "error", err)
+		os.Exit(1)
 	}
-	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		panic(err)
+	sloConfig, _ := sloConfigFromEnv()
+	slos := newSLOTracker(sloConfig)
+
+	shape, _ := responseShapeFromEnv()
+	securityHeadersConfig, _ := securityHeadersConfigFromEnv()
+	authConfig, _ := authConfigFromEnv()
+
+	useJSONFieldNames()
+	router := gin.New()
+	router.Use(assignRequestID, securityHeaders(securityHeadersConfig), accessLogger, trackSLO(slos), gin.CustomRecovery(respondToPanic), reportErrors(reporter), shapeResponses(shape), mapErrors)
+	router.Use(rejectWritesWhenReadOnly)
+	if switches.RequestTransactions {
+		router.Use(requestTransaction)
 	}
+	router.NoRoute(notFound)
 
-	fmt.Println("Connected to MySQL")
+	auth := router.Group("/auth")
+	{
+		auth.POST("/register", register(authConfig, userSvc))
+		auth.POST("/login", login(authConfig, userSvc))
+	}
 
-	router := gin.Default()
+	authenticated := router.Group("", requireUser(authConfig))
 
-	todos :=router.Group("/todos")
+	todos := authenticated.Group("/todos")
 	{
-		todos.GET("", getTodos)
-		todos.POST("", createTodo)
+		todos.GET("", getTodos(todoSvc))
+		todos.POST("", createTodo(todoSvc))
+		todos.GET("/calendar", getTodosCalendar(todoSvc))
+		todos.GET("/changes", skipLatencySLO, getTodoChanges(todoSvc))
+		todos.POST("/exists", checkTodosExist(todoSvc))
+		todos.GET("/trash", getTrash(todoSvc))
+		todos.POST("/batch", createTodosBatch(todoSvc))
+		todos.PATCH("/batch", completeTodosBatch(todoSvc))
+		todos.DELETE("/batch", deleteTodosBatch(todoSvc))
 
 		todo := todos.Group("/:id")
 		{
-			todo.GET("", getTodo)
-			todo.PATCH("", toggleTodoStatus)
-			todo.PUT("", updateTodo)
-			todo.DELETE("", deleteTodo)
+			todo.GET("", getTodo(todoSvc))
+			todo.PATCH("", toggleTodoStatus(todoSvc))
+			todo.PUT("", updateTodo(todoSvc))
+			todo.DELETE("", deleteTodo(todoSvc))
+			todo.POST("/restore", restoreTodo(todoSvc))
+			todo.DELETE("/purge", purgeTodo(todoSvc))
+
+			todo.POST("/timer/start", startTimer(todoSvc))
+			todo.POST("/timer/stop", stopTimer(todoSvc))
+			todo.GET("/time-entries", getTimeEntries(todoSvc))
+			todo.POST("/time-entries", createTimeEntry(todoSvc))
 		}
 	}
 
-	router.Run("localhost:9191")
-}
\ No newline at end of file
+	pomodoro := authenticated.Group("/pomodoro")
+	{
+		pomodoro.POST("", startPomodoro(pomodoros))
+		pomodoro.GET("/events", skipLatencySLO, streamPomodoroEvents(pomodoros))
+		pomodoro.GET("/:id", getPomodoro(pomodoros))
+		pomodoro.POST("/:id/cancel", cancelPomodoro(pomodoros))
+	}
+
+	authenticated.GET("/reports/estimates", getEstimatesReport(todoSvc))
+	authenticated.GET("/me/heatmap", getHeatmap(todoSvc))
+	authenticated.GET("/me/backup", getBackup(todoSvc))
+	authenticated.POST("/me/backup", restoreBackupFromRequest(todoSvc))
+	authenticated.POST("/me/feed-token", issueFeedToken(userSvc))
+	authenticated.DELETE("/me/feed-token", revokeFeedToken(userSvc))
+	authenticated.POST("/me/api-key", issueAPIKey(userSvc))
+	authenticated.DELETE("/me/api-key", revokeAPIKey(userSvc))
+	router.GET("/feeds/todos.atom", getTodosFeed(userSvc, todoSvc))
+	router.GET("/healthz", getHealthz)
+	router.GET("/readyz", getReadyz)
+
+	zapier := router.Group("/zapier", requireAPIKey(userSvc))
+	{
+		zapier.GET("/me", getZapierMe)
+		zapier.GET("/triggers/new_todo", getNewTodoTrigger(todoSvc))
+		zapier.GET("/triggers/todo_completed", getTodoCompletedTrigger(todoSvc))
+		zapier.POST("/actions/create_todo", createTodo(todoSvc))
+		zapier.POST("/actions/complete_todo", completeTodoAction(todoSvc))
+	}
+
+	admin := router.Group("/admin", requireAdminKey)
+	{
+		admin.GET("/read-only", getReadOnly)
+		admin.PUT("/read-only", setReadOnly)
+		admin.GET("/slo", getSLOReport(slos))
+	}
+
+	registerTodoLinks(router.Routes())
+
+	server := &http.Server{Addr: serverConfig.ListenAddr, Handler: router}
+	if err := serve(server, serverConfig.ShutdownTimeout); err != nil {
+		slog.Error("serving", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serveTodos(router *gin.Engine, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func newTodosRouter(todos todoService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ginContext *gin.Context) { ginContext.Set(userIDKey, int64(1)) }, mapErrors)
+	router.GET("/todos", getTodos(todos))
+	return router
+}
+
+func TestGetTodosPagesShareTheEnvelope(t *testing.T) {
+	repo := newMemoryTodoRepository()
+	todos := newTodoService(repo)
+	for _, item := range []string{"one", "two", "three"} {
+		if _, err := todos.Create(context.Background(), 1, todoPayload{Item: item}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := newTodosRouter(todos)
+
+	for target, want := range map[string]todoListResponse{
+		"/todos?limit=2":        {Page: 1, Limit: 2, Total: 3, TotalPages: 2, Todos: make([]todo, 2)},
+		"/todos?limit=2&page=2": {Page: 2, Limit: 2, Total: 3, TotalPages: 2, Todos: make([]todo, 1)},
+	} {
+		recorder := serveTodos(router, target)
+		var got todoListResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v in %s", target, err, recorder.Body)
+		}
+		if got.Page != want.Page || got.Limit != want.Limit || got.Total != want.Total ||
+			got.TotalPages != want.TotalPages || len(got.Todos) != len(want.Todos) {
+			t.Errorf("%s: got %+v, want %+v", target, got, want)
+		}
+	}
+}
+
+func TestGetTodosSharesTheFirstPage(t *testing.T) {
+	repo := newMemoryTodoRepository()
+	repo.countGate = make(chan struct{})
+	router := newTodosRouter(newTodoService(repo))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if recorder := serveTodos(router, "/todos"); recorder.Code != http.StatusOK {
+				t.Errorf("got %d, want 200", recorder.Code)
+			}
+		}()
+	}
+	// Give the requests time to join the first one's query.
+	time.Sleep(50 * time.Millisecond)
+	close(repo.countGate)
+	wg.Wait()
+
+	if calls := repo.called("Count"); calls != 1 {
+		t.Errorf("5 concurrent requests counted %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,8 @@
+CREATE TABLE time_entries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    todo_id INT NOT NULL,
+    started_at DATETIME NOT NULL,
+    stopped_at DATETIME NULL,
+    INDEX idx_time_entries_todo_id (todo_id),
+    CONSTRAINT fk_time_entries_todo FOREIGN KEY (todo_id) REFERENCES todos (id) ON DELETE CASCADE
+);
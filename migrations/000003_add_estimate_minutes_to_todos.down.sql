@@ -0,0 +1 @@
+ALTER TABLE todos DROP COLUMN estimate_minutes;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN estimate_minutes INT NULL;
\ No newline at end of file
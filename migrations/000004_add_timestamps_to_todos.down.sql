@@ -0,0 +1,5 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_completed_at,
+    DROP INDEX idx_todos_created_at,
+    DROP COLUMN completed_at,
+    DROP COLUMN created_at;
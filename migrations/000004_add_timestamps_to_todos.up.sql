@@ -0,0 +1,5 @@
+ALTER TABLE todos
+    ADD COLUMN created_at DATETIME NOT NULL DEFAULT (UTC_TIMESTAMP()),
+    ADD COLUMN completed_at DATETIME NULL,
+    ADD INDEX idx_todos_created_at (created_at),
+    ADD INDEX idx_todos_completed_at (completed_at);
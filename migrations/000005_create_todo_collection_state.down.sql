@@ -0,0 +1 @@
+DROP TABLE IF EXISTS todo_collection_state;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE todo_collection_state (
+    id TINYINT UNSIGNED PRIMARY KEY,
+    last_modified DATETIME NOT NULL
+);
+
+INSERT INTO todo_collection_state (id, last_modified) VALUES (1, UTC_TIMESTAMP());
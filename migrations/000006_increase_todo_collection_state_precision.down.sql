@@ -0,0 +1 @@
+ALTER TABLE todo_collection_state MODIFY last_modified DATETIME NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE todo_collection_state MODIFY last_modified DATETIME(6) NOT NULL;
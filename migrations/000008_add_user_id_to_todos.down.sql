@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    DROP FOREIGN KEY fk_todos_user,
+    DROP INDEX idx_todos_user_id,
+    DROP COLUMN user_id;
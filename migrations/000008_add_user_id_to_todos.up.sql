@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN user_id INT NULL,
+    ADD INDEX idx_todos_user_id (user_id),
+    ADD CONSTRAINT fk_todos_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_user_id_deleted_at,
+    DROP COLUMN deleted_at;
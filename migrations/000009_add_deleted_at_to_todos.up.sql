@@ -0,0 +1,3 @@
+ALTER TABLE todos
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD INDEX idx_todos_user_id_deleted_at (user_id, deleted_at);
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    DROP INDEX idx_todos_user_id_due_date,
+    DROP COLUMN priority,
+    DROP COLUMN due_date;
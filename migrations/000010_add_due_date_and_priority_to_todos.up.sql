@@ -0,0 +1,4 @@
+ALTER TABLE todos
+    ADD COLUMN due_date DATETIME NULL,
+    ADD COLUMN priority ENUM('low', 'medium', 'high') NULL,
+    ADD INDEX idx_todos_user_id_due_date (user_id, due_date);
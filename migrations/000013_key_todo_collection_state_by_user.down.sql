@@ -0,0 +1,8 @@
+DROP TABLE todo_collection_state;
+
+CREATE TABLE todo_collection_state (
+    id TINYINT UNSIGNED PRIMARY KEY,
+    last_modified DATETIME(6) NOT NULL
+);
+
+INSERT INTO todo_collection_state (id, last_modified) VALUES (1, UTC_TIMESTAMP(6));
@@ -0,0 +1,7 @@
+DROP TABLE todo_collection_state;
+
+CREATE TABLE todo_collection_state (
+    user_id INT PRIMARY KEY,
+    last_modified DATETIME(6) NOT NULL,
+    CONSTRAINT fk_todo_collection_state_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    DROP INDEX idx_users_api_key_hash,
+    DROP INDEX idx_users_feed_token_hash,
+    DROP COLUMN api_key_hash,
+    DROP COLUMN feed_token_hash;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN feed_token_hash CHAR(64) NULL,
+    ADD COLUMN api_key_hash CHAR(64) NULL,
+    ADD UNIQUE INDEX idx_users_feed_token_hash (feed_token_hash),
+    ADD UNIQUE INDEX idx_users_api_key_hash (api_key_hash);
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPomodoroMinutes = 25
+	pomodoroRetention      = time.Hour
+	pomodoroReadOnlyRetry  = time.Minute
+)
+
+type pomodoroSession struct {
+	ID        int       `json:"id"`
+	TodoID    int64     `json:"todo_id"`
+	StartedAt time.Time `json:"started_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	State     string    `json:"state"`
+
+	userID int64
+	timer  *time.Timer
+}
+
+type pomodoroEvent struct {
+	Type    string          `json:"type"`
+	Session pomodoroSession `json:"session"`
+}
+
+type pomodoroPayload struct {
+	TodoID          int64 `json:"todo_id" binding:"required,min=1"`
+	DurationMinutes int   `json:"duration_minutes" binding:"omitempty,min=1,max=120"`
+}
+
+// pomodoroHub keeps sessions in memory, so running sessions do not survive a
+// restart. Only completed sessions are persisted, as time entries. Sessions
+// and their events are only visible to the user who started them.
+type pomodoroHub struct {
+	todos       todoService
+	mu          sync.Mutex
+	nextID      int
+	sessions    map[int]*pomodoroSession
+	subscribers map[chan pomodoroEvent]int64
+}
+
+func newPomodoroHub(todos todoService) *pomodoroHub {
+	return &pomodoroHub{
+		todos:       todos,
+		sessions:    map[int]*pomodoroSession{},
+		subscribers: map[chan pomodoroEvent]int64{},
+	}
+}
+
+func (hub *pomodoroHub) start(userID, todoID int64, duration time.Duration) pomodoroSession {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.nextID++
+	startedAt := time.Now().UTC().Truncate(time.Second)
+	session := &pomodoroSession{
+		ID:        hub.nextID,
+		TodoID:    todoID,
+		StartedAt: startedAt,
+		EndsAt:    startedAt.Add(duration),
+		State:     "running",
+		userID:    userID,
+	}
+	session.timer = time.AfterFunc(duration, func() { hub.finish(session.ID, "completed") })
+	hub.sessions[session.ID] = session
+	hub.publish(pomodoroEvent{Type: "started", Session: *session})
+	return *session
+}
+
+func (hub *pomodoroHub) get(userID int64, id int) (pomodoroSession, bool) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	session, ok := hub.sessions[id]
+	if !ok || session.userID != userID {
+		return pomodoroSession{}, false
+	}
+	return *session, true
+}
+
+func (hub *pomodoroHub) finish(id int, state string) (pomodoroSession, bool) {
+	hub.mu.Lock()
+	session, ok := hub.sessions[id]
+	if !ok || session.State != "running" {
+		hub.mu.Unlock()
+		return pomodoroSession{}, false
+	}
+	session.timer.Stop()
+	session.State = state
+	if state != "completed" {
+		session.EndsAt = time.Now().UTC().Truncate(time.Second)
+	}
+	finished := *session
+	hub.publish(pomodoroEvent{Type: state, Session: finished})
+	hub.mu.Unlock()
+
+	if state == "completed" {
+		hub.logTimeEntry(finished)
+	}
+
+	time.AfterFunc(pomodoroRetention, func() {
+		hub.mu.Lock()
+		delete(hub.sessions, id)
+		hub.mu.Unlock()
+	})
+	return finished, true
+}
+
+// logTimeEntry persists a completed session. In read-only mode the write is
+// retried every pomodoroReadOnlyRetry until writes are enabled again; it is
+// lost if the instance stops first.
+func (hub *pomodoroHub) logTimeEntry(session pomodoroSession) {
+	if readOnly.Load() {
+		time.AfterFunc(pomodoroReadOnlyRetry, func() { hub.logTimeEntry(session) })
+		return
+	}
+	_, err := hub.todos.AddTimeEntry(context.Background(), session.userID, session.TodoID, session.StartedAt, session.EndsAt)
+	if err != nil {
+		slog.Error("pomodoro: logging time entry failed", "pomodoro_id", session.ID, "error", err)
+	}
+}
+
+// publish must be called with hub.mu held. Slow subscribers miss events
+// rather than blocking the hub.
+func (hub *pomodoroHub) publish(event pomodoroEvent) {
+	for subscriber, userID := range hub.subscribers {
+		if userID != event.Session.userID {
+			continue
+		}
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (hub *pomodoroHub) subscribe(userID int64) chan pomodoroEvent {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	subscriber := make(chan pomodoroEvent, 16)
+	hub.subscribers[subscriber] = userID
+	return subscriber
+}
+
+func (hub *pomodoroHub) unsubscribe(subscriber chan pomodoroEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	delete(hub.subscribers, subscriber)
+}
+
+var (
+	errPomodoroNotFound  = newDomainError(errNotFound, "pomodoro session not found")
+	errNoRunningPomodoro = newDomainError(errNotFound, "no running pomodoro session")
+)
+
+func parsePomodoroID(ginContext *gin.Context) (int, error) {
+	id, err := strconv.Atoi(ginContext.Param("id"))
+	if err != nil {
+		return 0, newDomainError(errValidation, "invalid id format")
+	}
+	return id, nil
+}
+
+func startPomodoro(hub *pomodoroHub) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload pomodoroPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		userID := currentUserID(ginContext)
+		if _, err := hub.todos.Get(ginContext.Request.Context(), userID, payload.TodoID); err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		minutes := payload.DurationMinutes
+		if minutes == 0 {
+			minutes = defaultPomodoroMinutes
+		}
+
+		session := hub.start(userID, payload.TodoID, time.Duration(minutes)*time.Minute)
+		respondCreated(ginContext, fmt.Sprintf("/pomodoro/%d", session.ID), session)
+	}
+}
+
+func getPomodoro(hub *pomodoroHub) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parsePomodoroID(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		session, ok := hub.get(currentUserID(ginContext), id)
+		if !ok {
+			ginContext.Error(errPomodoroNotFound)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, session)
+	}
+}
+
+func cancelPomodoro(hub *pomodoroHub) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parsePomodoroID(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		if _, ok := hub.get(currentUserID(ginContext), id); !ok {
+			ginContext.Error(errPomodoroNotFound)
+			return
+		}
+
+		session, ok := hub.finish(id, "cancelled")
+		if !ok {
+			ginContext.Error(errNoRunningPomodoro)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, session)
+	}
+}
+
+func streamPomodoroEvents(hub *pomodoroHub) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		events := hub.subscribe(currentUserID(ginContext))
+		defer hub.unsubscribe(events)
+
+		ginContext.Stream(func(w io.Writer) bool {
+			select {
+			case event := <-events:
+				ginContext.SSEvent(event.Type, event)
+				return true
+			case <-ginContext.Request.Context().Done():
+				return false
+			case <-shuttingDown.Done():
+				return false
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnly makes the API reject writes during failovers, restores and
+// storage maintenance. It starts from READ_ONLY and can be flipped at runtime
+// through PUT /admin/read-only; the switch is kept per instance.
+var readOnly atomic.Bool
+
+var errReadOnly = newDomainError(errReadOnlyMode, "the API is in read-only mode, writes are disabled")
+
+var errAdminDisabled = newDomainError(errNotFound, "admin endpoints are disabled")
+
+// adminAPIKey is sent in the X-API-Key header. The admin endpoints are
+// disabled when ADMIN_API_KEY is unset.
+var adminAPIKey = configValue("ADMIN_API_KEY")
+
+// readOnlySafeRoutes are requests with a write method that do not change
+// anything, plus the switch itself.
+var readOnlySafeRoutes = map[string]bool{
+	"/auth/login":      true,
+	"/todos/exists":    true,
+	"/admin/read-only": true,
+}
+
+type readOnlyPayload struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+func rejectWritesWhenReadOnly(ginContext *gin.Context) {
+	switch ginContext.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if readOnly.Load() && !readOnlySafeRoutes[ginContext.FullPath()] {
+			ginContext.Error(errReadOnly)
+			ginContext.Abort()
+			return
+		}
+	}
+	ginContext.Next()
+}
+
+// rejectedAsReadOnly reports whether the request was turned away by
+// rejectWritesWhenReadOnly. Those 503s are deliberate, not failures.
+func rejectedAsReadOnly(ginContext *gin.Context) bool {
+	return len(ginContext.Errors) > 0 && errors.Is(ginContext.Errors.Last().Err, errReadOnly)
+}
+
+func requireAdminKey(ginContext *gin.Context) {
+	if adminAPIKey == "" {
+		ginContext.Error(errAdminDisabled)
+		ginContext.Abort()
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(ginContext.GetHeader("X-API-Key")), []byte(adminAPIKey)) != 1 {
+		ginContext.Error(errInvalidAPIKey)
+		ginContext.Abort()
+		return
+	}
+	ginContext.Next()
+}
+
+func getReadOnly(ginContext *gin.Context) {
+	ginContext.JSON(http.StatusOK, gin.H{"enabled": readOnly.Load()})
+}
+
+func setReadOnly(ginContext *gin.Context) {
+	var payload readOnlyPayload
+	if err := ginContext.ShouldBindJSON(&payload); err != nil {
+		ginContext.Error(validationError(err))
+		return
+	}
+
+	readOnly.Store(*payload.Enabled)
+	ginContext.JSON(http.StatusOK, gin.H{"enabled": *payload.Enabled})
+}
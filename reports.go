@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type estimatesReportRow struct {
+	Week            string `json:"week"`
+	Todos           int    `json:"todos"`
+	EstimateMinutes int64  `json:"estimate_minutes"`
+	TrackedMinutes  int64  `json:"tracked_minutes"`
+	VarianceMinutes int64  `json:"variance_minutes"`
+}
+
+func getEstimatesReport(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		report, err := todos.EstimatesReport(ginContext.Request.Context(), currentUserID(ginContext))
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// validRequestID limits the ids accepted from clients and proxies to ones
+// that are safe to echo in headers and log lines.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// assignRequestID keeps the X-Request-ID a proxy or client sent, or generates
+// one, and returns it in the response. It is stored in the request context
+// so every log line written for the request carries it.
+func assignRequestID(ginContext *gin.Context) {
+	id := ginContext.GetHeader(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = newRequestID()
+	}
+	ginContext.Header(requestIDHeader, id)
+	ginContext.Request = ginContext.Request.WithContext(
+		context.WithValue(ginContext.Request.Context(), requestIDKey{}, id),
+	)
+	ginContext.Next()
+}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDHandler adds the request_id of the context to each record.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (handler requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// strictRESTResponses makes every request behave as if it sent
+// "Prefer: return=minimal", for gateways that reject bodies on deletes. It is
+// set from STRICT_REST_RESPONSES at startup.
+var strictRESTResponses bool
+
+// preferences parses the RFC 7240 "Prefer" headers into lower-cased
+// preference names and their values ("" for bare tokens like "omit-null").
+func preferences(ginContext *gin.Context) map[string]string {
+	parsed := map[string]string{}
+	for _, header := range ginContext.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(preference), "=")
+			parsed[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return parsed
+}
+
+// prefersMinimal reports whether the client asked for an empty response via
+// "Prefer: return=minimal", or strict mode is enabled.
+func prefersMinimal(ginContext *gin.Context) bool {
+	return strictRESTResponses || strings.EqualFold(preferences(ginContext)["return"], "minimal")
+}
+
+func respondCreated(ginContext *gin.Context, location string, body any) {
+	ginContext.Header("Location", location)
+	ginContext.JSON(http.StatusCreated, body)
+}
+
+// respondDeleted answers a successful delete with 204 No Content when the
+// client prefers a minimal response and with the deleted resource otherwise.
+func respondDeleted(ginContext *gin.Context, deleted any) {
+	if prefersMinimal(ginContext) {
+		ginContext.Writer.Header().Add("Preference-Applied", "return=minimal")
+		ginContext.Status(http.StatusNoContent)
+		return
+	}
+	ginContext.JSON(http.StatusOK, deleted)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.up.sql
+var migrationFiles embed.FS
+
+const startupCheckTimeout = 5 * time.Second
+
+const (
+	checkOK      = "ok"
+	checkWarn    = "warn"
+	checkFail    = "fail"
+	checkSkipped = "skipped"
+)
+
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type startupReport struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+func (report *startupReport) add(name, status, detail string) {
+	report.Checks = append(report.Checks, checkResult{Name: name, Status: status, Detail: detail})
+	if status == checkFail {
+		report.Status = checkFail
+	}
+}
+
+// runStartupChecks validates the configuration, connects to MySQL and
+// verifies the schema version. On success the global db handle is ready to
+// use; checks that depend on a failed one are reported as skipped.
+func runStartupChecks() startupReport {
+	report := startupReport{Status: checkOK}
+
+	if err := checkConfig(); err != nil {
+		report.add("config", checkFail, err.Error())
+		report.add("storage", checkSkipped, "config check failed")
+		report.add("database", checkSkipped, "config check failed")
+		report.add("schema", checkSkipped, "config check failed")
+		return report
+	}
+	if configValue("JWT_SECRET") == "" {
+		report.add("config", checkWarn, "JWT_SECRET is not set, so tokens are signed with a random secret and stop working on restart and on other instances")
+	} else {
+		report.add("config", checkOK, "")
+	}
+
+	if err := checkStorage(); err != nil {
+		report.add("storage", checkFail, err.Error())
+	} else {
+		report.add("storage", checkOK, "")
+	}
+
+	config, _ := serverConfigFromEnv()
+	if err := connectDatabase(config); err != nil {
+		report.add("database", checkFail, err.Error())
+		report.add("schema", checkSkipped, "database check failed")
+		return report
+	}
+	report.add("database", checkOK, "")
+
+	status, detail := checkSchemaVersion()
+	report.add("schema", status, detail)
+	return report
+}
+
+func checkConfig() error {
+	if _, err := serverConfigFromEnv(); err != nil {
+		return err
+	}
+	if _, err := accessLogConfigFromEnv(); err != nil {
+		return err
+	}
+	if _, err := errorReportingConfigFromEnv(); err != nil {
+		return err
+	}
+	if _, err := sloConfigFromEnv(); err != nil {
+		return err
+	}
+	if _, err := responseShapeFromEnv(); err != nil {
+		return err
+	}
+	if _, err := securityHeadersConfigFromEnv(); err != nil {
+		return err
+	}
+	if _, err := authConfigFromEnv(); err != nil {
+		return err
+	}
+	if _, err := featureSwitchesFromEnv(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkStorage verifies that every path the server writes to is writable.
+func checkStorage() error {
+	config, _ := accessLogConfigFromEnv()
+	if config.Sink != "file" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.FilePath), 0o755); err != nil {
+		return fmt.Errorf("access log directory is not writable: %w", err)
+	}
+	file, err := os.OpenFile(config.FilePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("access log file is not writable: %w", err)
+	}
+	return file.Close()
+}
+
+func connectDatabase(config serverConfig) error {
+	var err error
+	db, err = sql.Open("mysql", config.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupCheckTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return fmt.Errorf("cannot reach MySQL: %w", err)
+	}
+	return nil
+}
+
+func checkSchemaVersion() (string, string) {
+	expected, err := latestMigrationVersion()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupCheckTimeout)
+	defer cancel()
+
+	var version int
+	var dirty bool
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return checkFail, "no migrations have been applied, run make migrate-up"
+	} else if err != nil {
+		return checkFail, fmt.Sprintf("cannot read schema_migrations, run make migrate-up: %v", err)
+	}
+
+	switch {
+	case dirty:
+		return checkFail, fmt.Sprintf("migration %d failed halfway and left the schema dirty", version)
+	case version < expected:
+		return checkFail, fmt.Sprintf("schema is at version %d, expected %d, run make migrate-up", version, expected)
+	case version > expected:
+		return checkWarn, fmt.Sprintf("schema is at version %d, newer than the expected %d", version, expected)
+	}
+	return checkOK, fmt.Sprintf("version %d", version)
+}
+
+func latestMigrationVersion() (int, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	latest := 0
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "migrations/"), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected migration file name %q", name)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
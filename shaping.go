@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	namingSnakeCase = "snake_case"
+	namingCamelCase = "camelCase"
+)
+
+type responseShape struct {
+	Naming   string
+	OmitNull bool
+}
+
+// responseShapeFromEnv reads the server-wide default; clients override it per
+// request with "Prefer: naming=camelCase" and "Prefer: omit-null".
+func responseShapeFromEnv() (responseShape, error) {
+	shape := responseShape{Naming: configOrDefault("JSON_FIELD_NAMING", namingSnakeCase)}
+	var err error
+	if shape.OmitNull, err = configBool("JSON_OMIT_NULL"); err != nil {
+		return shape, err
+	}
+	if shape.Naming != namingSnakeCase && shape.Naming != namingCamelCase {
+		return shape, fmt.Errorf("JSON_FIELD_NAMING must be snake_case or camelCase, got %q", shape.Naming)
+	}
+	return shape, nil
+}
+
+// shapingWriter buffers JSON bodies so their keys can be rewritten once the
+// handler is done. Anything else, such as event streams, is passed through.
+type shapingWriter struct {
+	gin.ResponseWriter
+	buffer      bytes.Buffer
+	decided     bool
+	passthrough bool
+}
+
+func (writer *shapingWriter) decide() {
+	if !writer.decided {
+		writer.decided = true
+		writer.passthrough = !strings.HasPrefix(writer.Header().Get("Content-Type"), "application/json")
+	}
+}
+
+func (writer *shapingWriter) Write(data []byte) (int, error) {
+	writer.decide()
+	if writer.passthrough {
+		return writer.ResponseWriter.Write(data)
+	}
+	return writer.buffer.Write(data)
+}
+
+func (writer *shapingWriter) WriteString(data string) (int, error) {
+	writer.decide()
+	if writer.passthrough {
+		return writer.ResponseWriter.WriteString(data)
+	}
+	return writer.buffer.WriteString(data)
+}
+
+func (writer *shapingWriter) Written() bool {
+	return writer.buffer.Len() > 0 || writer.ResponseWriter.Written()
+}
+
+func (writer *shapingWriter) Flush() {
+	if writer.decided && writer.passthrough {
+		writer.ResponseWriter.Flush()
+	}
+}
+
+// shapeResponses applies the negotiated field naming and null omission to
+// JSON responses. Shaped responses are buffered in full, so streamed lists
+// lose their streaming when a shape other than the default is requested.
+func shapeResponses(defaults responseShape) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		shape := defaults
+		preferred := preferences(ginContext)
+		if naming, ok := preferred["naming"]; ok && (naming == namingSnakeCase || naming == namingCamelCase) {
+			shape.Naming = naming
+			ginContext.Writer.Header().Add("Preference-Applied", "naming="+naming)
+		}
+		if _, ok := preferred["omit-null"]; ok {
+			shape.OmitNull = true
+			ginContext.Writer.Header().Add("Preference-Applied", "omit-null")
+		}
+		if shape.Naming == namingSnakeCase && !shape.OmitNull {
+			ginContext.Next()
+			return
+		}
+
+		// Deferred so a panicking handler leaves the real writer in place for
+		// the recovery handler's response.
+		writer := &shapingWriter{ResponseWriter: ginContext.Writer}
+		ginContext.Writer = writer
+		defer func() {
+			ginContext.Writer = writer.ResponseWriter
+			if writer.passthrough || writer.buffer.Len() == 0 {
+				return
+			}
+			body := writer.buffer.Bytes()
+			if shaped, err := shapeJSON(body, shape); err == nil {
+				body = shaped
+			}
+			writer.ResponseWriter.Write(body)
+		}()
+		ginContext.Next()
+	}
+}
+
+func shapeJSON(body []byte, shape responseShape) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(shapeValue(value, shape))
+}
+
+func shapeValue(value any, shape responseShape) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		shaped := make(map[string]any, len(typed))
+		for key, field := range typed {
+			if field == nil && shape.OmitNull {
+				continue
+			}
+			if shape.Naming == namingCamelCase {
+				key = camelCase(key)
+			}
+			shaped[key] = shapeValue(field, shape)
+		}
+		return shaped
+	case []any:
+		for i, element := range typed {
+			typed[i] = shapeValue(element, shape)
+		}
+		return typed
+	}
+	return value
+}
+
+// camelCase converts snake_case keys, keeping leading underscores so
+// "_links" stays recognisable.
+func camelCase(key string) string {
+	trimmed := strings.TrimLeft(key, "_")
+	parts := strings.Split(trimmed, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return key[:len(key)-len(trimmed)] + strings.Join(parts, "")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shuttingDown is cancelled once a graceful shutdown starts. Long polls and
+// event streams end early when it is, as they would otherwise hold up the
+// shutdown until its timeout.
+var shuttingDown, startShutdown = context.WithCancel(context.Background())
+
+// serve runs the server until SIGINT or SIGTERM, then stops accepting
+// connections and waits up to timeout for in-flight requests to finish. A
+// second signal during that wait exits immediately.
+func serve(server *http.Server, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server.RegisterOnShutdown(startShutdown)
+
+	serverErrors := make(chan error, 1)
+	go func() { serverErrors <- server.ListenAndServe() }()
+
+	select {
+	case err := <-serverErrors:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutting down, waiting for requests to finish", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-serverErrors; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import "sync"
+
+type flightCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// flightGroup collapses concurrent calls with the same key into one: the
+// first caller runs fn and everyone arriving while it runs shares the
+// result. Shared values must be treated as read-only.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+func (group *flightGroup[T]) do(key string, fn func() (T, error)) (T, error) {
+	group.mu.Lock()
+	if group.calls == nil {
+		group.calls = map[string]*flightCall[T]{}
+	}
+	if call, ok := group.calls[key]; ok {
+		group.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &flightCall[T]{done: make(chan struct{})}
+	group.calls[key] = call
+	group.mu.Unlock()
+
+	defer func() {
+		group.mu.Lock()
+		delete(group.calls, key)
+		group.mu.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = fn()
+	return call.value, call.err
+}
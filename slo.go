@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sloBucketCount      = 60
+	sloShortWindow      = 5
+	sloLongWindow       = 60
+	sloMinShortRequests = 10
+	sloAlertCooldown    = 15 * time.Minute
+	sloSkipLatencyKey   = "slo.skip_latency"
+)
+
+type sloConfig struct {
+	AvailabilityTarget float64
+	LatencyTarget      float64
+	LatencyThreshold   time.Duration
+	BurnRateThreshold  float64
+	AlertWebhookURL    string
+}
+
+func sloConfigFromEnv() (sloConfig, error) {
+	config := sloConfig{
+		AvailabilityTarget: 0.999,
+		LatencyTarget:      0.99,
+		LatencyThreshold:   300 * time.Millisecond,
+		BurnRateThreshold:  14.4,
+		AlertWebhookURL:    configValue("SLO_ALERT_WEBHOOK_URL"),
+	}
+
+	ratios := map[string]*float64{
+		"SLO_AVAILABILITY_TARGET": &config.AvailabilityTarget,
+		"SLO_LATENCY_TARGET":      &config.LatencyTarget,
+	}
+	for key, target := range ratios {
+		if value := configValue(key); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 || parsed >= 1 {
+				return config, fmt.Errorf("%s must be between 0 and 1 exclusive, got %q", key, value)
+			}
+			*target = parsed
+		}
+	}
+	if value := configValue("SLO_LATENCY_THRESHOLD_MS"); value != "" {
+		milliseconds, err := strconv.Atoi(value)
+		if err != nil || milliseconds < 1 {
+			return config, fmt.Errorf("SLO_LATENCY_THRESHOLD_MS must be a positive integer, got %q", value)
+		}
+		config.LatencyThreshold = time.Duration(milliseconds) * time.Millisecond
+	}
+	if value := configValue("SLO_BURN_RATE_THRESHOLD"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			return config, fmt.Errorf("SLO_BURN_RATE_THRESHOLD must be a positive number, got %q", value)
+		}
+		config.BurnRateThreshold = parsed
+	}
+	return config, nil
+}
+
+// sloBucket counts the requests of one minute.
+type sloBucket struct {
+	minute int64
+	total  int64
+	errors int64
+	timed  int64
+	slow   int64
+}
+
+type routeSLO struct {
+	buckets    [sloBucketCount]sloBucket
+	lastAlerts map[string]time.Time
+}
+
+type sloWindow struct {
+	total, errors, timed, slow int64
+}
+
+func (route *routeSLO) window(nowMinute int64, minutes int64) sloWindow {
+	var window sloWindow
+	for _, bucket := range route.buckets {
+		if bucket.minute > nowMinute-minutes && bucket.minute <= nowMinute {
+			window.total += bucket.total
+			window.errors += bucket.errors
+			window.timed += bucket.timed
+			window.slow += bucket.slow
+		}
+	}
+	return window
+}
+
+// burnRate is how many times faster than allowed the error budget is spent:
+// 1 exhausts it exactly at the end of the SLO period.
+func burnRate(bad, total int64, target float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / (1 - target)
+}
+
+type sloObjective struct {
+	Target      float64 `json:"target"`
+	BurnRate5m  float64 `json:"burn_rate_5m"`
+	BurnRate1h  float64 `json:"burn_rate_1h"`
+	GoodRatio1h float64 `json:"good_ratio_1h"`
+}
+
+type sloRouteReport struct {
+	Route        string       `json:"route"`
+	Requests1h   int64        `json:"requests_1h"`
+	Availability sloObjective `json:"availability"`
+	Latency      sloObjective `json:"latency"`
+}
+
+type sloAlert struct {
+	Route      string  `json:"route"`
+	Objective  string  `json:"objective"`
+	BurnRate5m float64 `json:"burn_rate_5m"`
+	BurnRate1h float64 `json:"burn_rate_1h"`
+	Threshold  float64 `json:"threshold"`
+}
+
+// sloTracker keeps one hour of per-route request counts in memory, so each
+// instance reports on the traffic it served.
+type sloTracker struct {
+	mu     sync.Mutex
+	config sloConfig
+	routes map[string]*routeSLO
+	client *http.Client
+}
+
+func newSLOTracker(config sloConfig) *sloTracker {
+	return &sloTracker{
+		config: config,
+		routes: map[string]*routeSLO{},
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (tracker *sloTracker) record(name string, status int, latency time.Duration, countLatency bool) {
+	now := time.Now()
+	nowMinute := now.Unix() / 60
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	route, ok := tracker.routes[name]
+	if !ok {
+		route = &routeSLO{lastAlerts: map[string]time.Time{}}
+		tracker.routes[name] = route
+	}
+
+	bucket := &route.buckets[nowMinute%sloBucketCount]
+	if bucket.minute != nowMinute {
+		*bucket = sloBucket{minute: nowMinute}
+	}
+	bucket.total++
+	if status >= http.StatusInternalServerError {
+		bucket.errors++
+	}
+	if countLatency {
+		bucket.timed++
+		if latency > tracker.config.LatencyThreshold {
+			bucket.slow++
+		}
+	}
+
+	tracker.checkBurnRates(name, route, nowMinute, now)
+}
+
+// checkBurnRates alerts when both the 5 minute and the 1 hour burn rate of
+// an objective exceed the threshold, so short blips do not page anyone.
+// Must be called with tracker.mu held.
+func (tracker *sloTracker) checkBurnRates(name string, route *routeSLO, nowMinute int64, now time.Time) {
+	if tracker.config.AlertWebhookURL == "" {
+		return
+	}
+
+	short := route.window(nowMinute, sloShortWindow)
+	if short.total < sloMinShortRequests {
+		return
+	}
+	long := route.window(nowMinute, sloLongWindow)
+
+	objectives := map[string][2]float64{
+		"availability": {
+			burnRate(short.errors, short.total, tracker.config.AvailabilityTarget),
+			burnRate(long.errors, long.total, tracker.config.AvailabilityTarget),
+		},
+		"latency": {
+			burnRate(short.slow, short.timed, tracker.config.LatencyTarget),
+			burnRate(long.slow, long.timed, tracker.config.LatencyTarget),
+		},
+	}
+	for objective, rates := range objectives {
+		if rates[0] < tracker.config.BurnRateThreshold || rates[1] < tracker.config.BurnRateThreshold {
+			continue
+		}
+		if now.Sub(route.lastAlerts[objective]) < sloAlertCooldown {
+			continue
+		}
+		route.lastAlerts[objective] = now
+		go tracker.sendAlert(sloAlert{
+			Route:      name,
+			Objective:  objective,
+			BurnRate5m: rates[0],
+			BurnRate1h: rates[1],
+			Threshold:  tracker.config.BurnRateThreshold,
+		})
+	}
+}
+
+func (tracker *sloTracker) sendAlert(alert sloAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	response, err := tracker.client.Post(tracker.config.AlertWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("slo: sending alert failed", "objective", alert.Objective, "route", alert.Route, "error", err)
+		return
+	}
+	response.Body.Close()
+}
+
+func (tracker *sloTracker) report() []sloRouteReport {
+	nowMinute := time.Now().Unix() / 60
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	var reports = []sloRouteReport{}
+	for name, route := range tracker.routes {
+		short := route.window(nowMinute, sloShortWindow)
+		long := route.window(nowMinute, sloLongWindow)
+		if long.total == 0 {
+			continue
+		}
+
+		report := sloRouteReport{
+			Route:      name,
+			Requests1h: long.total,
+			Availability: sloObjective{
+				Target:      tracker.config.AvailabilityTarget,
+				BurnRate5m:  burnRate(short.errors, short.total, tracker.config.AvailabilityTarget),
+				BurnRate1h:  burnRate(long.errors, long.total, tracker.config.AvailabilityTarget),
+				GoodRatio1h: 1 - float64(long.errors)/float64(long.total),
+			},
+			Latency: sloObjective{
+				Target:      tracker.config.LatencyTarget,
+				BurnRate5m:  burnRate(short.slow, short.timed, tracker.config.LatencyTarget),
+				BurnRate1h:  burnRate(long.slow, long.timed, tracker.config.LatencyTarget),
+				GoodRatio1h: 1,
+			},
+		}
+		if long.timed > 0 {
+			report.Latency.GoodRatio1h = 1 - float64(long.slow)/float64(long.timed)
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Route < reports[j].Route })
+	return reports
+}
+
+func trackSLO(tracker *sloTracker) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		start := time.Now()
+		ginContext.Next()
+
+		route := ginContext.FullPath()
+		if route == "" || rejectedAsReadOnly(ginContext) {
+			return
+		}
+		tracker.record(
+			ginContext.Request.Method+" "+route,
+			ginContext.Writer.Status(),
+			time.Since(start),
+			!ginContext.GetBool(sloSkipLatencyKey),
+		)
+	}
+}
+
+// skipLatencySLO excludes long-lived requests (long polling, event streams)
+// from the latency objective; they still count towards availability.
+func skipLatencySLO(ginContext *gin.Context) {
+	ginContext.Set(sloSkipLatencyKey, true)
+}
+
+func getSLOReport(tracker *sloTracker) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		ginContext.JSON(http.StatusOK, gin.H{
+			"latency_threshold_ms": tracker.config.LatencyThreshold.Milliseconds(),
+			"routes":               tracker.report(),
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// todoTagsColumn selects a todo's tag names as one comma separated string,
+// which is why tag names cannot contain commas.
+const todoTagsColumn = `(SELECT GROUP_CONCAT(tags.name ORDER BY tags.name SEPARATOR ',')
+		FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE todo_tags.todo_id = todos.id)`
+
+func splitTags(names sql.NullString) []string {
+	if !names.Valid || names.String == "" {
+		return []string{}
+	}
+	return strings.Split(names.String, ",")
+}
+
+// setTodoTags replaces the tags of a todo, creating the user's tags that do
+// not exist yet. Tags are shared by all todos of a user and are matched
+// case-insensitively.
+func setTodoTags(ctx context.Context, tx *sql.Tx, userID, todoID int64, names []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = ?", todoID); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO tags (user_id, name) VALUES (?, ?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)",
+			userID, name,
+		)
+		if err != nil {
+			return err
+		}
+		tagID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO todo_tags (todo_id, tag_id) VALUES (?, ?)", todoID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type timeEntry struct {
+	ID        int        `json:"id"`
+	TodoID    int        `json:"todo_id"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+	Seconds   int64      `json:"seconds"`
+}
+
+type timeEntryPayload struct {
+	StartedAt time.Time `json:"started_at" binding:"required"`
+	StoppedAt time.Time `json:"stopped_at" binding:"required,gtfield=StartedAt"`
+}
+
+var (
+	errTimerRunning   = newDomainError(errConflict, "timer already running")
+	errNoRunningTimer = newDomainError(errNotFound, "no running timer")
+)
+
+func startTimer(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		entry, err := todos.StartTimer(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusCreated, entry)
+	}
+}
+
+func stopTimer(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		entry, err := todos.StopTimer(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, entry)
+	}
+}
+
+func getTimeEntries(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		entries, err := todos.TimeEntries(ginContext.Request.Context(), currentUserID(ginContext), id)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, entries)
+	}
+}
+
+func createTimeEntry(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		id, err := parseIDParam(ginContext)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		var payload timeEntryPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		entry, err := todos.AddTimeEntry(ginContext.Request.Context(), currentUserID(ginContext), id, payload.StartedAt, payload.StoppedAt)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusCreated, entry)
+	}
+}
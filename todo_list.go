@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTodoPageLimit = 50
+	maxTodoPageLimit     = 500
+
+	// maxTodoOffset bounds the OFFSET a page can reach, so (page-1)*limit
+	// cannot overflow whatever int size the server is built with.
+	maxTodoOffset = 1<<31 - 1
+)
+
+// todoSortColumns maps the accepted ?sort= values onto columns; only these
+// ever reach the ORDER BY clause.
+var todoSortColumns = map[string]string{
+	"id":        "id",
+	"item":      "item",
+	"completed": "completed",
+}
+
+var todoPriorities = map[string]bool{"low": true, "medium": true, "high": true}
+
+type todoListQuery struct {
+	page  int
+	limit int
+	where []string
+	args  []any
+	sort  string
+	order string
+}
+
+func parseTodoListQuery(ginContext *gin.Context) (todoListQuery, error) {
+	query := todoListQuery{page: 1, limit: defaultTodoPageLimit, sort: "id", order: "ASC"}
+
+	if pageParam := ginContext.Query("page"); pageParam != "" {
+		page, err := strconv.Atoi(pageParam)
+		if err != nil || page < 1 {
+			return query, newDomainError(errValidation, "page must be a positive integer")
+		}
+		query.page = page
+	}
+	if limitParam := ginContext.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxTodoPageLimit {
+			return query, newDomainError(errValidation, "limit must be between 1 and "+strconv.Itoa(maxTodoPageLimit))
+		}
+		query.limit = limit
+	}
+	if query.page-1 > maxTodoOffset/query.limit {
+		return query, newDomainError(errValidation, "page must be at most "+strconv.Itoa(maxTodoOffset/query.limit+1)+" for a limit of "+strconv.Itoa(query.limit))
+	}
+
+	if completedParam := ginContext.Query("completed"); completedParam != "" {
+		completed, err := strconv.ParseBool(completedParam)
+		if err != nil {
+			return query, newDomainError(errValidation, "completed must be true or false")
+		}
+		query.where = append(query.where, "completed = ?")
+		query.args = append(query.args, completed)
+	}
+	if search := ginContext.Query("q"); search != "" {
+		query.where = append(query.where, "item LIKE ?")
+		query.args = append(query.args, "%"+escapeLike(search)+"%")
+	}
+	if tag := ginContext.Query("tag"); tag != "" {
+		query.where = append(query.where,
+			"id IN (SELECT todo_tags.todo_id FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE tags.name = ?)",
+		)
+		query.args = append(query.args, tag)
+	}
+	if priority := ginContext.Query("priority"); priority != "" {
+		if !todoPriorities[priority] {
+			return query, newDomainError(errValidation, "priority must be low, medium or high")
+		}
+		query.where = append(query.where, "priority = ?")
+		query.args = append(query.args, priority)
+	}
+	if dueBeforeParam := ginContext.Query("due_before"); dueBeforeParam != "" {
+		dueBefore, err := time.Parse(time.RFC3339, dueBeforeParam)
+		if err != nil {
+			return query, newDomainError(errValidation, "due_before must be an RFC 3339 timestamp")
+		}
+		query.where = append(query.where, "due_date < ?")
+		query.args = append(query.args, dueBefore.UTC())
+	}
+
+	if sortParam := ginContext.Query("sort"); sortParam != "" {
+		column, ok := todoSortColumns[sortParam]
+		if !ok {
+			return query, newDomainError(errValidation, "sort must be id, item or completed")
+		}
+		query.sort = column
+	}
+	switch strings.ToLower(ginContext.DefaultQuery("order", "asc")) {
+	case "asc":
+	case "desc":
+		query.order = "DESC"
+	default:
+		return query, newDomainError(errValidation, "order must be asc or desc")
+	}
+
+	return query, nil
+}
+
+// escapeLike makes the wildcards in a search term match literally.
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+func (query todoListQuery) whereClause() string {
+	if len(query.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(query.where, " AND ")
+}
+
+// forUser restricts the query to one user's todos outside the trash.
+func (query todoListQuery) forUser(userID int64) todoListQuery {
+	query.where = append([]string{"user_id = ?", "deleted_at IS NULL"}, query.where...)
+	query.args = append([]any{userID}, query.args...)
+	return query
+}
+
+func (query todoListQuery) countSQL() string {
+	return "SELECT COUNT(*) FROM todos" + query.whereClause()
+}
+
+// selectSQL orders by id last so pages are stable when the sort column has
+// duplicates.
+func (query todoListQuery) selectSQL() (string, []any) {
+	orderBy := query.sort + " " + query.order
+	if query.sort != "id" {
+		orderBy += ", id " + query.order
+	}
+	statement := selectTodos + query.whereClause() + " ORDER BY " + orderBy + " LIMIT ? OFFSET ?"
+	return statement, append(query.args[:len(query.args):len(query.args)], query.limit, (query.page-1)*query.limit)
+}
+
+// key identifies the query among the same user's, for sharing it between
+// concurrent callers.
+func (query todoListQuery) key() string {
+	return fmt.Sprintf("%d/%d/%s/%s/%q/%v", query.page, query.limit, query.sort, query.order, query.where, query.args)
+}
+
+func (query todoListQuery) totalPages(total int) int {
+	return (total + query.limit - 1) / query.limit
+}
@@ -0,0 +1,900 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// todoRepository stores each user's todos. Every method only sees the todos
+// of the given user: other users' todos are reported as errTodoNotFound just
+// like unknown ids. Deleted todos go to the trash, where only Trash, Restore
+// and Purge see them. A dry run performs the change and rolls it back,
+// returning the todo as it would have been.
+type todoRepository interface {
+	Count(ctx context.Context, userID int64, query todoListQuery) (int, error)
+	Each(ctx context.Context, userID int64, query todoListQuery, fn func(todo) error) error
+	Get(ctx context.Context, userID, id int64) (todo, error)
+	Create(ctx context.Context, userID int64, payload todoPayload, dryRun bool) (todo, error)
+	Update(ctx context.Context, userID, id int64, payload todoPayload, dryRun bool) (todo, error)
+	Toggle(ctx context.Context, userID, id int64) (todo, error)
+	Complete(ctx context.Context, userID, id int64) (todo, error)
+	Delete(ctx context.Context, userID, id int64) (todo, error)
+
+	CreateMany(ctx context.Context, userID int64, payloads []todoPayload) ([]todo, error)
+	SetCompleted(ctx context.Context, userID int64, ids []int64, completed bool) ([]todo, error)
+	DeleteMany(ctx context.Context, userID int64, ids []int64) ([]todo, error)
+
+	Trash(ctx context.Context, userID int64) ([]todo, error)
+	Restore(ctx context.Context, userID, id int64) (todo, error)
+	Purge(ctx context.Context, userID, id int64) (todo, error)
+
+	Existing(ctx context.Context, userID int64, ids []int64) (map[int64]bool, error)
+	Calendar(ctx context.Context, userID int64, from, until time.Time) ([]calendarDay, error)
+	RecentlyCompleted(ctx context.Context, userID int64, limit int) ([]todo, error)
+	Events(ctx context.Context, userID int64, limit int) ([]todoEvent, error)
+
+	StartTimer(ctx context.Context, userID, todoID int64) (timeEntry, error)
+	StopTimer(ctx context.Context, userID, todoID int64) (timeEntry, error)
+	TimeEntries(ctx context.Context, userID, todoID int64) ([]timeEntry, error)
+	AddTimeEntry(ctx context.Context, userID, todoID int64, startedAt, stoppedAt time.Time) (timeEntry, error)
+	HasRunningTimer(ctx context.Context, userID int64) (bool, error)
+
+	LastModified(ctx context.Context, userID int64) (lastModified, now time.Time, err error)
+	CompletionsPerDay(ctx context.Context, userID int64, from, until time.Time) ([]heatmapDay, error)
+	EstimatesReport(ctx context.Context, userID int64) ([]estimatesReportRow, error)
+	UsersWithCompletionsSince(ctx context.Context, since time.Time) ([]int64, error)
+
+	Backup(ctx context.Context, userID int64) (backup, error)
+	RestoreBackup(ctx context.Context, dump backup) error
+	MergeBackup(ctx context.Context, userID int64, dump backup, replace bool) error
+}
+
+const todoColumns = `id, item, completed, estimate_minutes, due_date, priority, ` + todoTagsColumn + `,
+	(SELECT COALESCE(SUM(TIMESTAMPDIFF(SECOND, started_at, COALESCE(stopped_at, UTC_TIMESTAMP()))), 0)
+		FROM time_entries WHERE todo_id = todos.id),
+	created_at, completed_at, deleted_at`
+
+const selectTodos = "SELECT " + todoColumns + " FROM todos"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// todoScanBuffer holds the scan destinations for one todo row. Buffers are
+// pooled so listing a page does not allocate the destination slice and the
+// tags holder for every row; the pointer fields are replaced by each Scan, so
+// todos copied out of a buffer never share memory with the next row.
+type todoScanBuffer struct {
+	todo todo
+	tags sql.NullString
+	dest []any
+}
+
+var todoScanBuffers = sync.Pool{
+	New: func() any {
+		buffer := &todoScanBuffer{}
+		t := &buffer.todo
+		buffer.dest = []any{
+			&t.ID, &t.Item, &t.Completed, &t.EstimateMinutes, &t.DueDate, &t.Priority, &buffer.tags,
+			&t.TrackedSeconds, &t.CreatedAt, &t.CompletedAt, &t.DeletedAt,
+		}
+		return buffer
+	},
+}
+
+func scanTodo(row rowScanner) (todo, error) {
+	buffer := todoScanBuffers.Get().(*todoScanBuffer)
+	defer todoScanBuffers.Put(buffer)
+
+	err := row.Scan(buffer.dest...)
+	t := buffer.todo
+	if err == sql.ErrNoRows {
+		return todo{}, errTodoNotFound
+	}
+	if err != nil {
+		return todo{}, err
+	}
+	t.Tags = splitTags(buffer.tags)
+	t.Links = linksForTodo(t.ID, t.DeletedAt != nil)
+	return t, nil
+}
+
+// mysqlTodoRepository keeps todos in the todos table of the global db. Every
+// mutation bumps the user's list version (see touchTodos) in the same
+// transaction.
+type mysqlTodoRepository struct{}
+
+// touchTodos records that the user's todo collection changed. It must run in
+// the same transaction as the change so the timestamp never precedes the
+// data. Each user has their own row, so users' writes neither wake each
+// other's long polls nor wait on each other's row lock.
+func touchTodos(ctx context.Context, tx *sql.Tx, userID int64) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO todo_collection_state (user_id, last_modified) VALUES (?, UTC_TIMESTAMP(6))
+			ON DUPLICATE KEY UPDATE last_modified = UTC_TIMESTAMP(6)`,
+		userID,
+	)
+	return err
+}
+
+// touchAllTodos is touchTodos for every user, after a full restore.
+func touchAllTodos(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO todo_collection_state (user_id, last_modified) SELECT id, UTC_TIMESTAMP(6) FROM users
+			ON DUPLICATE KEY UPDATE last_modified = UTC_TIMESTAMP(6)`,
+	)
+	return err
+}
+
+// LastModified falls back to the user's creation time while they have not
+// changed anything yet.
+func (mysqlTodoRepository) LastModified(ctx context.Context, userID int64) (lastModified, now time.Time, err error) {
+	err = db.QueryRowContext(ctx,
+		`SELECT COALESCE(state.last_modified, users.created_at), UTC_TIMESTAMP(6)
+			FROM users LEFT JOIN todo_collection_state state ON state.user_id = users.id
+			WHERE users.id = ?`,
+		userID,
+	).Scan(&lastModified, &now)
+	return lastModified, now, err
+}
+
+func (mysqlTodoRepository) Count(ctx context.Context, userID int64, query todoListQuery) (int, error) {
+	query = query.forUser(userID)
+	var total int
+	err := db.QueryRowContext(ctx, query.countSQL(), query.args...).Scan(&total)
+	return total, err
+}
+
+// Each calls fn for every todo on the query's page while the rows are being
+// read, and stops at the first error fn returns.
+func (mysqlTodoRepository) Each(ctx context.Context, userID int64, query todoListQuery, fn func(todo) error) error {
+	statement, args := query.forUser(userID).selectSQL()
+	rows, err := db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func queryTodos(ctx context.Context, statement string, args ...any) ([]todo, error) {
+	rows, err := db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scratch := todoSlices.Get().(*[]todo)
+	defer putTodoSlice(scratch)
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		*scratch = append(*scratch, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return append(make([]todo, 0, len(*scratch)), *scratch...), nil
+}
+
+// todoSlices holds scratch slices that queryTodos collects rows into, so a
+// list grows in an already sized slice and is copied out with a single
+// allocation instead of reallocating as rows arrive.
+var todoSlices = sync.Pool{
+	New: func() any {
+		todos := make([]todo, 0, defaultTodoPageLimit)
+		return &todos
+	},
+}
+
+// maxPooledTodoSlice keeps one unusually long list from pinning its memory in
+// the pool.
+const maxPooledTodoSlice = 4 * maxTodoPageLimit
+
+func putTodoSlice(todos *[]todo) {
+	if cap(*todos) > maxPooledTodoSlice {
+		return
+	}
+	clear(*todos)
+	*todos = (*todos)[:0]
+	todoSlices.Put(todos)
+}
+
+func (mysqlTodoRepository) Get(ctx context.Context, userID, id int64) (todo, error) {
+	return scanTodo(db.QueryRowContext(ctx, selectTodos+" WHERE id = ? AND user_id = ? AND deleted_at IS NULL", id, userID))
+}
+
+func (mysqlTodoRepository) Create(ctx context.Context, userID int64, payload todoPayload, dryRun bool) (todo, error) {
+	var createdTodo todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		createdTodo, err = insertTodo(ctx, tx, userID, payload)
+		if err != nil {
+			return err
+		}
+		if err := touchTodos(ctx, tx, userID); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return createdTodo, err
+}
+
+func insertTodo(ctx context.Context, tx *sql.Tx, userID int64, payload todoPayload) (todo, error) {
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO todos (user_id, item, completed, estimate_minutes, due_date, priority, completed_at)
+			VALUES (?, ?, ?, ?, ?, ?, IF(?, UTC_TIMESTAMP(), NULL))`,
+		userID, payload.Item, payload.Completed, payload.EstimateMinutes, payload.dueDate(), payload.Priority, payload.Completed,
+	)
+	if err != nil {
+		return todo{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return todo{}, err
+	}
+	if err := setTodoTags(ctx, tx, userID, id, payload.Tags); err != nil {
+		return todo{}, err
+	}
+	return scanTodo(tx.QueryRowContext(ctx, selectTodos+" WHERE id = ?", id))
+}
+
+func (mysqlTodoRepository) Update(ctx context.Context, userID, id int64, payload todoPayload, dryRun bool) (todo, error) {
+	var updatedTodo todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockTodo(ctx, tx, userID, id); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`UPDATE todos SET item = ?, completed = ?, estimate_minutes = ?, due_date = ?, priority = ?,
+				completed_at = IF(?, COALESCE(completed_at, UTC_TIMESTAMP()), NULL)
+				WHERE id = ?`,
+			payload.Item, payload.Completed, payload.EstimateMinutes, payload.dueDate(), payload.Priority, payload.Completed, id,
+		)
+		if err != nil {
+			return err
+		}
+		if err := setTodoTags(ctx, tx, userID, id, payload.Tags); err != nil {
+			return err
+		}
+
+		updatedTodo, err = scanTodo(tx.QueryRowContext(ctx, selectTodos+" WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+		if err := touchTodos(ctx, tx, userID); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return updatedTodo, err
+}
+
+func (mysqlTodoRepository) Toggle(ctx context.Context, userID, id int64) (todo, error) {
+	var toggled todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		toggled, err = scanTodo(tx.QueryRowContext(ctx,
+			selectTodos+" WHERE id = ? AND user_id = ? AND deleted_at IS NULL FOR UPDATE", id, userID,
+		))
+		if err != nil {
+			return err
+		}
+
+		toggled.Completed = !toggled.Completed
+		toggled.CompletedAt = nil
+		if toggled.Completed {
+			completedAt := time.Now().UTC().Truncate(time.Second)
+			toggled.CompletedAt = &completedAt
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE todos SET completed = ?, completed_at = ? WHERE id = ?", toggled.Completed, toggled.CompletedAt, id)
+		if err != nil {
+			return err
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return toggled, err
+}
+
+// Complete marks the todo completed, keeping the original completion time
+// when it already was.
+func (mysqlTodoRepository) Complete(ctx context.Context, userID, id int64) (todo, error) {
+	var completedTodo todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockTodo(ctx, tx, userID, id); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx,
+			"UPDATE todos SET completed = TRUE, completed_at = COALESCE(completed_at, UTC_TIMESTAMP()) WHERE id = ?",
+			id,
+		)
+		if err != nil {
+			return err
+		}
+
+		completedTodo, err = scanTodo(tx.QueryRowContext(ctx, selectTodos+" WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return completedTodo, err
+}
+
+// Delete moves the todo to the trash.
+func (mysqlTodoRepository) Delete(ctx context.Context, userID, id int64) (todo, error) {
+	var deletedTodo todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockTodo(ctx, tx, userID, id); err != nil {
+			return err
+		}
+
+		var err error
+		deletedTodo, err = trashTodo(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return deletedTodo, err
+}
+
+func trashTodo(ctx context.Context, tx *sql.Tx, id int64) (todo, error) {
+	_, err := tx.ExecContext(ctx, "UPDATE todos SET deleted_at = UTC_TIMESTAMP() WHERE id = ?", id)
+	if err != nil {
+		return todo{}, err
+	}
+	return scanTodo(tx.QueryRowContext(ctx, selectTodos+" WHERE id = ?", id))
+}
+
+// CreateMany inserts all todos in one transaction; none is stored when one
+// fails.
+func (mysqlTodoRepository) CreateMany(ctx context.Context, userID int64, payloads []todoPayload) ([]todo, error) {
+	var createdTodos []todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		createdTodos = make([]todo, 0, len(payloads))
+		for _, payload := range payloads {
+			createdTodo, err := insertTodo(ctx, tx, userID, payload)
+			if err != nil {
+				return err
+			}
+			createdTodos = append(createdTodos, createdTodo)
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return createdTodos, err
+}
+
+// lockTodos is lockTodo for a batch of ids. The rows are locked in id order
+// by a single statement, so concurrent batches over the same todos cannot
+// deadlock. It fails on the first id the user has no todo for, naming it,
+// and returns the ids in request order without repeats.
+func lockTodos(ctx context.Context, tx *sql.Tx, userID int64, ids []int64) ([]int64, error) {
+	var unique []int64
+	args := []any{userID}
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+			args = append(args, id)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(unique)), ", ")
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id FROM todos WHERE user_id = ? AND deleted_at IS NULL AND id IN ("+placeholders+") ORDER BY id FOR UPDATE",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range unique {
+		if !found[id] {
+			return nil, newDomainError(errNotFound, fmt.Sprintf("todo %d not found", id))
+		}
+	}
+	return unique, nil
+}
+
+// SetCompleted marks the todos completed or not completed, keeping the
+// original completion time of those that already were. Either all todos are
+// changed or, when one of them does not exist, none.
+func (mysqlTodoRepository) SetCompleted(ctx context.Context, userID int64, ids []int64, completed bool) ([]todo, error) {
+	var updatedTodos []todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		locked, err := lockTodos(ctx, tx, userID, ids)
+		if err != nil {
+			return err
+		}
+
+		updatedTodos = make([]todo, 0, len(locked))
+		for _, id := range locked {
+			_, err := tx.ExecContext(ctx,
+				"UPDATE todos SET completed = ?, completed_at = IF(?, COALESCE(completed_at, UTC_TIMESTAMP()), NULL) WHERE id = ?",
+				completed, completed, id,
+			)
+			if err != nil {
+				return err
+			}
+
+			updatedTodo, err := scanTodo(tx.QueryRowContext(ctx, selectTodos+" WHERE id = ?", id))
+			if err != nil {
+				return err
+			}
+			updatedTodos = append(updatedTodos, updatedTodo)
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return updatedTodos, err
+}
+
+// DeleteMany moves the todos to the trash, all or none of them.
+func (mysqlTodoRepository) DeleteMany(ctx context.Context, userID int64, ids []int64) ([]todo, error) {
+	var deletedTodos []todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		locked, err := lockTodos(ctx, tx, userID, ids)
+		if err != nil {
+			return err
+		}
+
+		deletedTodos = make([]todo, 0, len(locked))
+		for _, id := range locked {
+			deletedTodo, err := trashTodo(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			deletedTodos = append(deletedTodos, deletedTodo)
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return deletedTodos, err
+}
+
+// Trash returns the user's deleted todos, most recently deleted first.
+func (mysqlTodoRepository) Trash(ctx context.Context, userID int64) ([]todo, error) {
+	return queryTodos(ctx,
+		selectTodos+" WHERE user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC", userID,
+	)
+}
+
+// lockTrashedTodo is lockTodo for todos in the trash; it returns the todo
+// and errTodoNotInTrash when the user has no such deleted todo.
+func lockTrashedTodo(ctx context.Context, tx *sql.Tx, userID, id int64) (todo, error) {
+	t, err := scanTodo(tx.QueryRowContext(ctx,
+		selectTodos+" WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL FOR UPDATE", id, userID,
+	))
+	if err == errTodoNotFound {
+		return t, errTodoNotInTrash
+	}
+	return t, err
+}
+
+func (mysqlTodoRepository) Restore(ctx context.Context, userID, id int64) (todo, error) {
+	var restoredTodo todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := lockTrashedTodo(ctx, tx, userID, id); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "UPDATE todos SET deleted_at = NULL WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		restoredTodo, err = scanTodo(tx.QueryRowContext(ctx, selectTodos+" WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return restoredTodo, err
+}
+
+// Purge removes a todo in the trash for good, together with its time entries.
+func (mysqlTodoRepository) Purge(ctx context.Context, userID, id int64) (todo, error) {
+	var purgedTodo todo
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		purgedTodo, err = lockTrashedTodo(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM todos WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		return touchTodos(ctx, tx, userID)
+	})
+	return purgedTodo, err
+}
+
+// Existing reports which of ids are todos of the user.
+func (mysqlTodoRepository) Existing(ctx context.Context, userID int64, ids []int64) (map[int64]bool, error) {
+	args := []any{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT id FROM todos WHERE user_id = ? AND deleted_at IS NULL AND id IN ("+placeholders+")", args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	return found, rows.Err()
+}
+
+// All buckets come from a single query; rows are ordered by day so they can
+// be grouped in one pass.
+const selectTodosCalendar = `SELECT 'created', DATE(created_at) AS day, ` + todoColumns + `
+	FROM todos WHERE user_id = ? AND deleted_at IS NULL AND created_at >= ? AND created_at < ?
+	UNION ALL
+	SELECT 'completed', DATE(completed_at) AS day, ` + todoColumns + `
+	FROM todos WHERE user_id = ? AND deleted_at IS NULL AND completed_at >= ? AND completed_at < ?
+	UNION ALL
+	SELECT 'due', DATE(due_date) AS day, ` + todoColumns + `
+	FROM todos WHERE user_id = ? AND deleted_at IS NULL AND due_date >= ? AND due_date < ?
+	ORDER BY day, id`
+
+type prefixScanner struct {
+	rowScanner
+	prefix []any
+}
+
+func (scanner prefixScanner) Scan(dest ...any) error {
+	return scanner.rowScanner.Scan(append(scanner.prefix, dest...)...)
+}
+
+// Calendar returns the days between from and until (exclusive) on which the
+// user created or completed todos or had todos due.
+func (mysqlTodoRepository) Calendar(ctx context.Context, userID int64, from, until time.Time) ([]calendarDay, error) {
+	rows, err := db.QueryContext(ctx, selectTodosCalendar,
+		userID, from, until,
+		userID, from, until,
+		userID, from, until,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days = []calendarDay{}
+	for rows.Next() {
+		var kind string
+		var day time.Time
+		t, err := scanTodo(prefixScanner{rows, []any{&kind, &day}})
+		if err != nil {
+			return nil, err
+		}
+
+		date := day.Format(calendarDateLayout)
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, calendarDay{Date: date, Created: []todo{}, Completed: []todo{}, Due: []todo{}})
+		}
+		bucket := &days[len(days)-1]
+		switch kind {
+		case "created":
+			bucket.Created = append(bucket.Created, t)
+		case "completed":
+			bucket.Completed = append(bucket.Completed, t)
+		case "due":
+			bucket.Due = append(bucket.Due, t)
+		}
+	}
+	return days, rows.Err()
+}
+
+// RecentlyCompleted returns up to limit completed todos, most recently
+// completed first.
+func (mysqlTodoRepository) RecentlyCompleted(ctx context.Context, userID int64, limit int) ([]todo, error) {
+	return queryTodos(ctx,
+		selectTodos+` WHERE user_id = ? AND deleted_at IS NULL AND completed_at IS NOT NULL
+			ORDER BY completed_at DESC, id DESC LIMIT ?`,
+		userID, limit,
+	)
+}
+
+const selectTodoEvents = `SELECT 'added', id, item, created_at AS happened_at FROM todos WHERE user_id = ? AND deleted_at IS NULL
+	UNION ALL
+	SELECT 'completed', id, item, completed_at AS happened_at FROM todos WHERE user_id = ? AND deleted_at IS NULL AND completed_at IS NOT NULL
+	ORDER BY happened_at DESC, id DESC
+	LIMIT ?`
+
+// Events returns up to limit of the user's todo additions and completions,
+// newest first.
+func (mysqlTodoRepository) Events(ctx context.Context, userID int64, limit int) ([]todoEvent, error) {
+	rows, err := db.QueryContext(ctx, selectTodoEvents, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events = []todoEvent{}
+	for rows.Next() {
+		var event todoEvent
+		if err := rows.Scan(&event.Kind, &event.TodoID, &event.Item, &event.HappenedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+const selectTimeEntries = `SELECT id, todo_id, started_at, stopped_at,
+	TIMESTAMPDIFF(SECOND, started_at, COALESCE(stopped_at, UTC_TIMESTAMP()))
+	FROM time_entries`
+
+func scanTimeEntry(row rowScanner) (timeEntry, error) {
+	var entry timeEntry
+	var stoppedAt sql.NullTime
+	err := row.Scan(&entry.ID, &entry.TodoID, &entry.StartedAt, &stoppedAt, &entry.Seconds)
+	if stoppedAt.Valid {
+		entry.StoppedAt = &stoppedAt.Time
+	}
+	return entry, err
+}
+
+// ownedTodo restricts time entry queries to the todos of one user.
+const ownedTodo = " AND todo_id IN (SELECT id FROM todos WHERE user_id = ? AND deleted_at IS NULL)"
+
+func (mysqlTodoRepository) StartTimer(ctx context.Context, userID, todoID int64) (timeEntry, error) {
+	entry := timeEntry{TodoID: int(todoID), StartedAt: time.Now().UTC().Truncate(time.Second)}
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockTodo(ctx, tx, userID, todoID); err != nil {
+			return err
+		}
+
+		var running bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM time_entries WHERE todo_id = ? AND stopped_at IS NULL)", todoID,
+		).Scan(&running)
+		if err != nil {
+			return err
+		}
+		if running {
+			return errTimerRunning
+		}
+
+		result, err := tx.ExecContext(ctx, "INSERT INTO time_entries (todo_id, started_at) VALUES (?, ?)", todoID, entry.StartedAt)
+		if err != nil {
+			return err
+		}
+		entryID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		entry.ID = int(entryID)
+		return touchTodos(ctx, tx, userID)
+	})
+	return entry, err
+}
+
+func (mysqlTodoRepository) StopTimer(ctx context.Context, userID, todoID int64) (timeEntry, error) {
+	var entry timeEntry
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		entry, err = scanTimeEntry(tx.QueryRowContext(ctx,
+			selectTimeEntries+" WHERE todo_id = ? AND stopped_at IS NULL"+ownedTodo+" FOR UPDATE", todoID, userID,
+		))
+		if err == sql.ErrNoRows {
+			return errNoRunningTimer
+		}
+		if err != nil {
+			return err
+		}
+
+		stoppedAt := time.Now().UTC().Truncate(time.Second)
+		if _, err := tx.ExecContext(ctx, "UPDATE time_entries SET stopped_at = ? WHERE id = ?", stoppedAt, entry.ID); err != nil {
+			return err
+		}
+		entry.StoppedAt = &stoppedAt
+		entry.Seconds = int64(stoppedAt.Sub(entry.StartedAt).Seconds())
+		return touchTodos(ctx, tx, userID)
+	})
+	return entry, err
+}
+
+func (mysqlTodoRepository) TimeEntries(ctx context.Context, userID, todoID int64) ([]timeEntry, error) {
+	rows, err := db.QueryContext(ctx,
+		selectTimeEntries+" WHERE todo_id = ?"+ownedTodo+" ORDER BY started_at", todoID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries = []timeEntry{}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// AddTimeEntry logs a finished stretch of work on the todo.
+func (mysqlTodoRepository) AddTimeEntry(ctx context.Context, userID, todoID int64, startedAt, stoppedAt time.Time) (timeEntry, error) {
+	startedAt = startedAt.UTC().Truncate(time.Second)
+	stoppedAt = stoppedAt.UTC().Truncate(time.Second)
+	entry := timeEntry{
+		TodoID:    int(todoID),
+		StartedAt: startedAt,
+		StoppedAt: &stoppedAt,
+		Seconds:   int64(stoppedAt.Sub(startedAt).Seconds()),
+	}
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockTodo(ctx, tx, userID, todoID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO time_entries (todo_id, started_at, stopped_at) VALUES (?, ?, ?)",
+			todoID, startedAt, stoppedAt,
+		)
+		if err != nil {
+			return err
+		}
+		entryID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		entry.ID = int(entryID)
+		return touchTodos(ctx, tx, userID)
+	})
+	return entry, err
+}
+
+func (mysqlTodoRepository) HasRunningTimer(ctx context.Context, userID int64) (bool, error) {
+	var running bool
+	err := db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM time_entries JOIN todos ON todos.id = time_entries.todo_id
+			WHERE todos.user_id = ? AND todos.deleted_at IS NULL AND time_entries.stopped_at IS NULL)`,
+		userID,
+	).Scan(&running)
+	return running, err
+}
+
+const selectCompletionsPerDay = `SELECT DATE(completed_at) AS day, COUNT(*)
+	FROM todos WHERE user_id = ? AND deleted_at IS NULL AND completed_at >= ? AND completed_at < ?
+	GROUP BY day
+	ORDER BY day`
+
+// CompletionsPerDay counts the todos completed on each day between from and
+// until (exclusive), skipping days without completions.
+func (mysqlTodoRepository) CompletionsPerDay(ctx context.Context, userID int64, from, until time.Time) ([]heatmapDay, error) {
+	rows, err := db.QueryContext(ctx, selectCompletionsPerDay, userID, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days = []heatmapDay{}
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		days = append(days, heatmapDay{Date: day.Format(calendarDateLayout), Count: count})
+	}
+	return days, rows.Err()
+}
+
+// Each estimated todo is attributed to the ISO week in which time was first
+// tracked on it, so a task worked on across weeks is only counted once.
+const selectEstimatesReport = `SELECT YEARWEEK(first_started_at, 3) AS week, COUNT(*),
+	SUM(estimate_minutes), SUM(tracked_seconds)
+	FROM (
+		SELECT todos.id, todos.estimate_minutes, MIN(time_entries.started_at) AS first_started_at,
+			SUM(TIMESTAMPDIFF(SECOND, time_entries.started_at, COALESCE(time_entries.stopped_at, UTC_TIMESTAMP()))) AS tracked_seconds
+		FROM todos
+		JOIN time_entries ON time_entries.todo_id = todos.id
+		WHERE todos.user_id = ? AND todos.deleted_at IS NULL AND todos.estimate_minutes IS NOT NULL
+		GROUP BY todos.id, todos.estimate_minutes
+	) AS estimated_todos
+	GROUP BY week
+	ORDER BY week`
+
+// EstimatesReport compares estimated and tracked time per ISO week.
+func (mysqlTodoRepository) EstimatesReport(ctx context.Context, userID int64) ([]estimatesReportRow, error) {
+	rows, err := db.QueryContext(ctx, selectEstimatesReport, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report = []estimatesReportRow{}
+	for rows.Next() {
+		var row estimatesReportRow
+		var yearWeek, trackedSeconds int64
+		if err := rows.Scan(&yearWeek, &row.Todos, &row.EstimateMinutes, &trackedSeconds); err != nil {
+			return nil, err
+		}
+		row.Week = fmt.Sprintf("%d-W%02d", yearWeek/100, yearWeek%100)
+		row.TrackedMinutes = (trackedSeconds + 30) / 60
+		row.VarianceMinutes = row.TrackedMinutes - row.EstimateMinutes
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// UsersWithCompletionsSince returns the users who completed a todo since
+// the given time.
+func (mysqlTodoRepository) UsersWithCompletionsSince(ctx context.Context, since time.Time) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT user_id FROM todos WHERE user_id IS NOT NULL AND completed_at >= ?", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// todoService holds the todo rules that do not depend on HTTP or on how todos
+// are stored: sharing list queries between callers, coalescing retried
+// toggles, caching heatmaps and checking backups before they are restored.
+// Writes that can change past completions drop the user's cached heatmaps.
+// Handlers are given the service, parse requests, call it and write the
+// response.
+type todoService struct {
+	repo     todoRepository
+	heatmaps *heatmapCache
+}
+
+func newTodoService(repo todoRepository) todoService {
+	return todoService{repo: repo, heatmaps: newHeatmapCache()}
+}
+
+var (
+	todoListFlights        flightGroup[todoList]
+	estimatesReportFlights flightGroup[[]estimatesReportRow]
+)
+
+// todoPage is one page of a list query. Its todos are not loaded; pass the
+// page to Each to read them.
+type todoPage struct {
+	userID int64
+	query  todoListQuery
+	total  int
+}
+
+func (service todoService) Page(ctx context.Context, userID int64, query todoListQuery) (todoPage, error) {
+	total, err := service.repo.Count(ctx, userID, query)
+	return todoPage{userID: userID, query: query, total: total}, err
+}
+
+func (service todoService) Each(ctx context.Context, page todoPage, fn func(todo) error) error {
+	return service.repo.Each(ctx, page.userID, page.query, fn)
+}
+
+// Newest returns up to limit todos, most recently created first.
+func (service todoService) Newest(ctx context.Context, userID int64, limit int) ([]todo, error) {
+	query := todoListQuery{page: 1, limit: limit, sort: "id", order: "DESC"}
+	var todos = []todo{}
+	err := service.repo.Each(ctx, userID, query, func(t todo) error {
+		todos = append(todos, t)
+		return nil
+	})
+	return todos, err
+}
+
+// todoList is a page of a list query with its todos loaded.
+type todoList struct {
+	todoPage
+	todos []todo
+}
+
+// List loads a page into memory, for responses that cannot be streamed. It
+// shares the queries between concurrent callers asking the same user's same
+// page. They are detached from the first caller's context so that caller
+// disconnecting does not fail everyone else waiting on it.
+func (service todoService) List(ctx context.Context, userID int64, query todoListQuery) (todoList, error) {
+	return todoListFlights.do(strconv.FormatInt(userID, 10)+"/"+query.key(), func() (todoList, error) {
+		ctx := context.WithoutCancel(ctx)
+		page, err := service.Page(ctx, userID, query)
+		if err != nil {
+			return todoList{}, err
+		}
+		list := todoList{todoPage: page, todos: []todo{}}
+		err = service.Each(ctx, page, func(t todo) error {
+			list.todos = append(list.todos, t)
+			return nil
+		})
+		return list, err
+	})
+}
+
+// HasRunningTimer reports whether one of the user's todos has a running
+// timer, whose tracked time grows without the todos being modified.
+func (service todoService) HasRunningTimer(ctx context.Context, userID int64) (bool, error) {
+	return service.repo.HasRunningTimer(ctx, userID)
+}
+
+func (service todoService) Get(ctx context.Context, userID, id int64) (todo, error) {
+	return service.repo.Get(ctx, userID, id)
+}
+
+func (service todoService) Create(ctx context.Context, userID int64, payload todoPayload, dryRun bool) (todo, error) {
+	return service.repo.Create(ctx, userID, payload, dryRun)
+}
+
+func (service todoService) Update(ctx context.Context, userID, id int64, payload todoPayload, dryRun bool) (todo, error) {
+	defer service.heatmaps.forget(userID)
+	return service.repo.Update(ctx, userID, id, payload, dryRun)
+}
+
+// Toggle flips the todo's completion. Toggles repeating a client operation
+// id are coalesced (see toggleCoalescer); duplicates wait for the first
+// toggle, so it must not be cancelled when that client goes away. Toggles
+// inside a request transaction are not coalesced: the first one could still
+// be rolled back after its duplicates were answered, and they would run in
+// its transaction.
+func (service todoService) Toggle(ctx context.Context, userID, id int64, opID string) (todo, error) {
+	defer service.heatmaps.forget(userID)
+	if opID == "" || inRequestTx(ctx) {
+		return service.repo.Toggle(ctx, userID, id)
+	}
+	return toggles.do(fmt.Sprintf("%d/%d/%s", userID, id, opID), func() (todo, error) {
+		return service.repo.Toggle(context.WithoutCancel(ctx), userID, id)
+	})
+}
+
+func (service todoService) Complete(ctx context.Context, userID, id int64) (todo, error) {
+	return service.repo.Complete(ctx, userID, id)
+}
+
+func (service todoService) Delete(ctx context.Context, userID, id int64) (todo, error) {
+	defer service.heatmaps.forget(userID)
+	return service.repo.Delete(ctx, userID, id)
+}
+
+func (service todoService) CreateMany(ctx context.Context, userID int64, payloads []todoPayload) ([]todo, error) {
+	return service.repo.CreateMany(ctx, userID, payloads)
+}
+
+func (service todoService) SetCompleted(ctx context.Context, userID int64, ids []int64, completed bool) ([]todo, error) {
+	defer service.heatmaps.forget(userID)
+	return service.repo.SetCompleted(ctx, userID, ids, completed)
+}
+
+func (service todoService) DeleteMany(ctx context.Context, userID int64, ids []int64) ([]todo, error) {
+	defer service.heatmaps.forget(userID)
+	return service.repo.DeleteMany(ctx, userID, ids)
+}
+
+func (service todoService) Trash(ctx context.Context, userID int64) ([]todo, error) {
+	return service.repo.Trash(ctx, userID)
+}
+
+func (service todoService) Restore(ctx context.Context, userID, id int64) (todo, error) {
+	defer service.heatmaps.forget(userID)
+	return service.repo.Restore(ctx, userID, id)
+}
+
+func (service todoService) Purge(ctx context.Context, userID, id int64) (todo, error) {
+	defer service.heatmaps.forget(userID)
+	return service.repo.Purge(ctx, userID, id)
+}
+
+func (service todoService) Existing(ctx context.Context, userID int64, ids []int64) (map[int64]bool, error) {
+	return service.repo.Existing(ctx, userID, ids)
+}
+
+func (service todoService) Calendar(ctx context.Context, userID int64, from, until time.Time) ([]calendarDay, error) {
+	return service.repo.Calendar(ctx, userID, from, until)
+}
+
+func (service todoService) RecentlyCompleted(ctx context.Context, userID int64, limit int) ([]todo, error) {
+	return service.repo.RecentlyCompleted(ctx, userID, limit)
+}
+
+func (service todoService) Events(ctx context.Context, userID int64, limit int) ([]todoEvent, error) {
+	return service.repo.Events(ctx, userID, limit)
+}
+
+func (service todoService) StartTimer(ctx context.Context, userID, todoID int64) (timeEntry, error) {
+	return service.repo.StartTimer(ctx, userID, todoID)
+}
+
+func (service todoService) StopTimer(ctx context.Context, userID, todoID int64) (timeEntry, error) {
+	return service.repo.StopTimer(ctx, userID, todoID)
+}
+
+func (service todoService) TimeEntries(ctx context.Context, userID, todoID int64) ([]timeEntry, error) {
+	return service.repo.TimeEntries(ctx, userID, todoID)
+}
+
+func (service todoService) AddTimeEntry(ctx context.Context, userID, todoID int64, startedAt, stoppedAt time.Time) (timeEntry, error) {
+	return service.repo.AddTimeEntry(ctx, userID, todoID, startedAt, stoppedAt)
+}
+
+func (service todoService) LastModified(ctx context.Context, userID int64) (lastModified, now time.Time, err error) {
+	return service.repo.LastModified(ctx, userID)
+}
+
+// CompletionsBefore returns the user's completions per day of year up to the
+// start of today, from the heatmap cache.
+func (service todoService) CompletionsBefore(ctx context.Context, userID int64, year int, today time.Time) ([]heatmapDay, error) {
+	return service.heatmaps.completionsBefore(ctx, service.repo, userID, year, today)
+}
+
+// Heatmap returns the user's completions per day of year. Past days come
+// from the cache; today's completions are always read live.
+func (service todoService) Heatmap(ctx context.Context, userID int64, year int, today time.Time) ([]heatmapDay, error) {
+	days, err := service.CompletionsBefore(ctx, userID, year, today)
+	if err != nil || year != today.Year() {
+		return days, err
+	}
+	todayDays, err := service.repo.CompletionsPerDay(ctx, userID, today, today.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	return append(days[:len(days):len(days)], todayDays...), nil
+}
+
+// EstimatesReport shares the query between concurrent callers for the same
+// user, like All.
+func (service todoService) EstimatesReport(ctx context.Context, userID int64) ([]estimatesReportRow, error) {
+	return estimatesReportFlights.do(strconv.FormatInt(userID, 10), func() ([]estimatesReportRow, error) {
+		return service.repo.EstimatesReport(context.WithoutCancel(ctx), userID)
+	})
+}
+
+func (service todoService) UsersWithCompletionsSince(ctx context.Context, since time.Time) ([]int64, error) {
+	return service.repo.UsersWithCompletionsSince(ctx, since)
+}
+
+// Backup dumps the user's todos, or with allUsers the whole database.
+func (service todoService) Backup(ctx context.Context, userID int64) (backup, error) {
+	return service.repo.Backup(ctx, userID)
+}
+
+// RestoreBackup replaces the whole database with a full dump. Dumps of a
+// single user are refused, as restoring one would delete every account.
+func (service todoService) RestoreBackup(ctx context.Context, dump backup) error {
+	if err := checkBackup(dump, backupScopeFull); err != nil {
+		return err
+	}
+	if len(dump.Users) == 0 {
+		return newDomainError(errValidation, "the backup has no users")
+	}
+	defer service.heatmaps.forgetAll()
+	return service.repo.RestoreBackup(ctx, dump)
+}
+
+// MergeBackup adds the todos of a user dump to the user's, after replacing
+// them when replace is set. The dump is validated before anything is
+// written.
+func (service todoService) MergeBackup(ctx context.Context, userID int64, dump backup, replace bool) error {
+	defer service.heatmaps.forget(userID)
+	if err := checkBackup(dump, backupScopeUser); err != nil {
+		return err
+	}
+	if err := validateBackup(dump); err != nil {
+		return err
+	}
+	return service.repo.MergeBackup(ctx, userID, dump, replace)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryTodoRepository is a todoRepository over a map, for testing
+// todoService without MySQL. List queries honour the page and limit only.
+// Methods the tests do not need fall through to the nil embedded interface
+// and panic.
+type memoryTodoRepository struct {
+	todoRepository
+
+	mu          sync.Mutex
+	nextID      int
+	todos       map[int]memoryTodo
+	completions map[time.Time]int
+	calls       map[string]int
+
+	lastModified time.Time
+	timerRunning bool
+	// countGate, when set, holds Count until it is closed.
+	countGate chan struct{}
+}
+
+type memoryTodo struct {
+	todo
+	userID int64
+}
+
+func newMemoryTodoRepository() *memoryTodoRepository {
+	return &memoryTodoRepository{
+		todos:       map[int]memoryTodo{},
+		completions: map[time.Time]int{},
+		calls:       map[string]int{},
+	}
+}
+
+func (repo *memoryTodoRepository) called(method string) int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return repo.calls[method]
+}
+
+// owned returns the user's todos ordered by id. repo.mu must be held.
+func (repo *memoryTodoRepository) owned(userID int64) []todo {
+	var todos []todo
+	for _, stored := range repo.todos {
+		if stored.userID == userID {
+			todos = append(todos, stored.todo)
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+	return todos
+}
+
+func (repo *memoryTodoRepository) Count(_ context.Context, userID int64, _ todoListQuery) (int, error) {
+	if repo.countGate != nil {
+		<-repo.countGate
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.calls["Count"]++
+	return len(repo.owned(userID)), nil
+}
+
+func (repo *memoryTodoRepository) Each(_ context.Context, userID int64, query todoListQuery, fn func(todo) error) error {
+	repo.mu.Lock()
+	todos := repo.owned(userID)
+	repo.calls["Each"]++
+	repo.mu.Unlock()
+
+	from := min((query.page-1)*query.limit, len(todos))
+	until := min(from+query.limit, len(todos))
+	for _, t := range todos[from:until] {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repo *memoryTodoRepository) Get(_ context.Context, userID, id int64) (todo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	stored, ok := repo.todos[int(id)]
+	if !ok || stored.userID != userID {
+		return todo{}, errTodoNotFound
+	}
+	return stored.todo, nil
+}
+
+func (repo *memoryTodoRepository) Create(_ context.Context, userID int64, payload todoPayload, dryRun bool) (todo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.nextID++
+	created := todo{ID: repo.nextID, Item: payload.Item, Completed: payload.Completed, Tags: payload.Tags, CreatedAt: time.Now().UTC()}
+	if !dryRun {
+		repo.todos[created.ID] = memoryTodo{todo: created, userID: userID}
+	}
+	return created, nil
+}
+
+func (repo *memoryTodoRepository) Toggle(_ context.Context, userID, id int64) (todo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.calls["Toggle"]++
+	stored, ok := repo.todos[int(id)]
+	if !ok || stored.userID != userID {
+		return todo{}, errTodoNotFound
+	}
+	stored.Completed = !stored.Completed
+	repo.todos[int(id)] = stored
+	return stored.todo, nil
+}
+
+func (repo *memoryTodoRepository) LastModified(context.Context, int64) (time.Time, time.Time, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return repo.lastModified, time.Now().UTC(), nil
+}
+
+func (repo *memoryTodoRepository) HasRunningTimer(context.Context, int64) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return repo.timerRunning, nil
+}
+
+func (repo *memoryTodoRepository) CompletionsPerDay(_ context.Context, _ int64, from, until time.Time) ([]heatmapDay, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.calls["CompletionsPerDay"]++
+	var days []heatmapDay
+	for day := from; day.Before(until); day = day.AddDate(0, 0, 1) {
+		if count := repo.completions[day]; count > 0 {
+			days = append(days, heatmapDay{Date: day.Format(calendarDateLayout), Count: count})
+		}
+	}
+	return days, nil
+}
+
+func (repo *memoryTodoRepository) RestoreBackup(context.Context, backup) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.calls["RestoreBackup"]++
+	return nil
+}
+
+func (repo *memoryTodoRepository) MergeBackup(context.Context, int64, backup, bool) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.calls["MergeBackup"]++
+	return nil
+}
+
+func TestTodoServicePage(t *testing.T) {
+	ctx := context.Background()
+	todos := newTodoService(newMemoryTodoRepository())
+	for _, item := range []string{"one", "two", "three"} {
+		if _, err := todos.Create(ctx, 1, todoPayload{Item: item}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := todos.Create(ctx, 2, todoPayload{Item: "not mine"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := todos.Page(ctx, 1, todoListQuery{page: 2, limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.total != 3 {
+		t.Errorf("got total %d, want 3", page.total)
+	}
+	var items []string
+	err = todos.Each(ctx, page, func(t todo) error {
+		items = append(items, t.Item)
+		return nil
+	})
+	if err != nil || len(items) != 1 || items[0] != "three" {
+		t.Errorf("got %v, %v, want [three]", items, err)
+	}
+}
+
+func TestTodoServiceList(t *testing.T) {
+	ctx := context.Background()
+	todos := newTodoService(newMemoryTodoRepository())
+	for _, item := range []string{"one", "two", "three"} {
+		if _, err := todos.Create(ctx, 3, todoPayload{Item: item}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := todos.List(ctx, 3, todoListQuery{page: 1, limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.total != 3 || len(list.todos) != 2 || list.todos[1].Item != "two" {
+		t.Errorf("got total %d and %v, want 3 and the first two todos", list.total, list.todos)
+	}
+}
+
+func TestTodoServiceToggleCoalescesRetries(t *testing.T) {
+	saved := toggles
+	toggles = &toggleCoalescer{recent: map[string]*coalescedToggle{}}
+	t.Cleanup(func() { toggles = saved })
+
+	ctx := context.Background()
+	repo := newMemoryTodoRepository()
+	todos := newTodoService(repo)
+	created, err := todos.Create(ctx, 1, todoPayload{Item: "toggle me"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int64(created.ID)
+
+	for range 3 {
+		toggled, err := todos.Toggle(ctx, 1, id, "TestTodoServiceToggleCoalescesRetries")
+		if err != nil || !toggled.Completed {
+			t.Fatalf("got %+v, %v, want the todo completed", toggled, err)
+		}
+	}
+	if calls := repo.called("Toggle"); calls != 1 {
+		t.Errorf("retries toggled %d times, want 1", calls)
+	}
+
+	if toggled, _ := todos.Toggle(ctx, 1, id, ""); toggled.Completed {
+		t.Error("a toggle without an operation id was coalesced")
+	}
+	if _, err := todos.Toggle(ctx, 2, id, "TestTodoServiceToggleCoalescesRetries"); !errors.Is(err, errTodoNotFound) {
+		t.Errorf("another user's toggle with the same operation id: got %v, want errTodoNotFound", err)
+	}
+
+	inTx := context.WithValue(ctx, requestTxKey{}, (*sql.Tx)(nil))
+	for range 2 {
+		todos.Toggle(inTx, 1, id, "TestTodoServiceToggleCoalescesRetries/tx")
+	}
+	if calls := repo.called("Toggle"); calls != 5 {
+		t.Errorf("toggles in a request transaction were coalesced: %d toggles, want 5", calls)
+	}
+}
+
+func TestTodoServiceHeatmap(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryTodoRepository()
+	todos := newTodoService(repo)
+	// Cache entries expire by the clock, so today has to be the real one.
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	earlier := time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	if earlier.Equal(today) {
+		t.Skip("no earlier day this year")
+	}
+	repo.completions[earlier] = 2
+	repo.completions[today] = 1
+
+	for range 2 {
+		days, err := todos.Heatmap(ctx, 1, today.Year(), today)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []heatmapDay{
+			{Date: earlier.Format(calendarDateLayout), Count: 2},
+			{Date: today.Format(calendarDateLayout), Count: 1},
+		}
+		if len(days) != len(want) || days[0] != want[0] || days[1] != want[1] {
+			t.Fatalf("got %v, want %v", days, want)
+		}
+	}
+	// Past days are cached; today is read on every call.
+	if calls := repo.called("CompletionsPerDay"); calls != 3 {
+		t.Errorf("got %d queries, want 3", calls)
+	}
+
+	// Toggling a todo may change past days.
+	created, err := todos.Create(ctx, 1, todoPayload{Item: "toggle me"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todos.Toggle(ctx, 1, int64(created.ID), "")
+	todos.Heatmap(ctx, 1, today.Year(), today)
+	if calls := repo.called("CompletionsPerDay"); calls != 5 {
+		t.Errorf("got %d queries after a toggle, want 5", calls)
+	}
+
+	days, err := todos.Heatmap(ctx, 1, today.Year()-1, today)
+	if err != nil || len(days) != 0 {
+		t.Errorf("got %v, %v for a past year, want no days", days, err)
+	}
+}
+
+func TestTodoServiceMergeBackupValidatesFirst(t *testing.T) {
+	ctx := context.Background()
+	userID := 1
+	tests := map[string]backup{
+		"other version": {Version: backupVersion + 1, Scope: backupScopeUser},
+		"full dump":     {Version: backupVersion, Scope: backupScopeFull, Users: []backupUser{{ID: 1}}},
+		"invalid todo":  {Version: backupVersion, Scope: backupScopeUser, Todos: []backupTodo{{ID: 1, Item: "x"}}},
+		"orphaned time entry": {
+			Version:     backupVersion,
+			Scope:       backupScopeUser,
+			Todos:       []backupTodo{{ID: 1, UserID: &userID, Item: "valid"}},
+			TimeEntries: []backupTimeEntry{{ID: 1, TodoID: 2}},
+		},
+	}
+	for name, dump := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newMemoryTodoRepository()
+			err := newTodoService(repo).MergeBackup(ctx, 1, dump, true)
+			if !errors.Is(err, errValidation) {
+				t.Errorf("got %v, want errValidation", err)
+			}
+			if calls := repo.called("MergeBackup"); calls != 0 {
+				t.Errorf("the repository was written %d times", calls)
+			}
+		})
+	}
+
+	repo := newMemoryTodoRepository()
+	dump := backup{Version: backupVersion, Scope: backupScopeUser, Todos: []backupTodo{{ID: 1, Item: "valid"}}}
+	if err := newTodoService(repo).MergeBackup(ctx, 1, dump, false); err != nil || repo.called("MergeBackup") != 1 {
+		t.Errorf("valid dump: got %v and %d writes, want one write", err, repo.called("MergeBackup"))
+	}
+}
+
+func TestTodoServiceRestoreBackupRefusesUserDumps(t *testing.T) {
+	ctx := context.Background()
+	tests := map[string]backup{
+		"user dump":          {Version: backupVersion, Scope: backupScopeUser},
+		"legacy user dump":   {Version: backupVersion},
+		"full dump no users": {Version: backupVersion, Scope: backupScopeFull},
+	}
+	for name, dump := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newMemoryTodoRepository()
+			if err := newTodoService(repo).RestoreBackup(ctx, dump); !errors.Is(err, errValidation) {
+				t.Errorf("got %v, want errValidation", err)
+			}
+			if calls := repo.called("RestoreBackup"); calls != 0 {
+				t.Errorf("the repository was written %d times", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestTxKey holds the transaction requestTransaction opens for each
+// mutating request when REQUEST_TRANSACTIONS is set.
+type requestTxKey struct{}
+
+// inRequestTx reports whether ctx carries a request transaction.
+func inRequestTx(ctx context.Context) bool {
+	_, ok := ctx.Value(requestTxKey{}).(*sql.Tx)
+	return ok
+}
+
+// bufferedWriter holds back the status line and body until the request
+// transaction has been committed.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	buffer bytes.Buffer
+}
+
+func (writer *bufferedWriter) Write(data []byte) (int, error) {
+	return writer.buffer.Write(data)
+}
+
+func (writer *bufferedWriter) WriteString(data string) (int, error) {
+	return writer.buffer.WriteString(data)
+}
+
+func (writer *bufferedWriter) WriteHeaderNow() {}
+
+func (writer *bufferedWriter) Written() bool {
+	return writer.buffer.Len() > 0 || writer.ResponseWriter.Written()
+}
+
+func (writer *bufferedWriter) Flush() {}
+
+// requestTransaction opens a transaction for each mutating request and
+// commits it when the handler answers with a 2xx status and reported no
+// error, rolling it back otherwise. The response is only sent once the
+// commit succeeded, so a failed commit turns into a 500 (via mapErrors)
+// rather than a success for lost writes.
+func requestTransaction(ginContext *gin.Context) {
+	switch ginContext.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		ginContext.Next()
+		return
+	}
+
+	tx, err := db.BeginTx(ginContext.Request.Context(), nil)
+	if err != nil {
+		ginContext.Error(err)
+		ginContext.Abort()
+		return
+	}
+	writer := &bufferedWriter{ResponseWriter: ginContext.Writer}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			ginContext.Writer = writer.ResponseWriter
+			tx.Rollback()
+			panic(recovered)
+		}
+	}()
+
+	ginContext.Request = ginContext.Request.WithContext(
+		context.WithValue(ginContext.Request.Context(), requestTxKey{}, tx),
+	)
+	ginContext.Writer = writer
+	ginContext.Next()
+	ginContext.Writer = writer.ResponseWriter
+
+	if status := ginContext.Writer.Status(); status < 200 || status >= 300 || len(ginContext.Errors) > 0 {
+		tx.Rollback()
+		// Nothing was written for a reported error: leave the response to
+		// mapErrors, which skips responses that are already written.
+		if writer.buffer.Len() == 0 {
+			return
+		}
+	} else if err := tx.Commit(); err != nil {
+		ginContext.Writer.Header().Del("Location")
+		ginContext.Error(err)
+		return
+	}
+	ginContext.Writer.Write(writer.buffer.Bytes())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// userRepository stores accounts and the hashes of the integration secrets
+// users issued. Emails are stored lowercased.
+type userRepository interface {
+	Create(ctx context.Context, email string, passwordHash []byte, createdAt time.Time) (int64, error)
+	ByEmail(ctx context.Context, email string) (user, []byte, error)
+	SetSecretHash(ctx context.Context, userID int64, column string, hash *string) error
+	BySecretHash(ctx context.Context, column, hash string) (int64, error)
+}
+
+var errUserNotFound = newDomainError(errNotFound, "user not found")
+
+// mysqlUserRepository keeps accounts in the users table of the global db.
+// Writes go through withTx so they join the request transaction.
+type mysqlUserRepository struct{}
+
+// Create returns errEmailTaken when the email is already registered.
+func (mysqlUserRepository) Create(ctx context.Context, email string, passwordHash []byte, createdAt time.Time) (int64, error) {
+	var userID int64
+	err := withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO users (email, password_hash, created_at) VALUES (?, ?, ?)",
+			email, passwordHash, createdAt,
+		)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			return errEmailTaken
+		} else if err != nil {
+			return err
+		}
+		userID, err = result.LastInsertId()
+		return err
+	})
+	return userID, err
+}
+
+// ByEmail returns the user and their password hash, or errUserNotFound.
+func (mysqlUserRepository) ByEmail(ctx context.Context, email string) (user, []byte, error) {
+	var u user
+	var hash []byte
+	err := db.QueryRowContext(ctx,
+		"SELECT id, email, password_hash, created_at FROM users WHERE email = ?", email,
+	).Scan(&u.ID, &u.Email, &hash, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return user{}, nil, errUserNotFound
+	}
+	return u, hash, err
+}
+
+// SetSecretHash stores hash in column, or clears it when hash is nil. column
+// is feedTokenColumn or apiKeyColumn.
+func (mysqlUserRepository) SetSecretHash(ctx context.Context, userID int64, column string, hash *string) error {
+	return withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET "+column+" = ? WHERE id = ?", hash, userID)
+		return err
+	})
+}
+
+// BySecretHash returns the user whose column holds hash, or 0 when none
+// does.
+func (mysqlUserRepository) BySecretHash(ctx context.Context, column, hash string) (int64, error) {
+	var userID int64
+	err := db.QueryRowContext(ctx, "SELECT id FROM users WHERE "+column+" = ?", hash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userID, err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// txLogDriver records every statement with whether it ran inside a
+// transaction.
+type txLogDriver struct {
+	mu         sync.Mutex
+	statements []loggedStatement
+}
+
+type loggedStatement struct {
+	query string
+	inTx  bool
+}
+
+func (logDriver *txLogDriver) Open(string) (driver.Conn, error) {
+	return &txLogConn{driver: logDriver}, nil
+}
+
+type txLogConn struct {
+	driver *txLogDriver
+	inTx   bool
+}
+
+func (*txLogConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (*txLogConn) Close() error { return nil }
+func (conn *txLogConn) Begin() (driver.Tx, error) {
+	conn.inTx = true
+	return conn, nil
+}
+func (conn *txLogConn) Commit() error   { conn.inTx = false; return nil }
+func (conn *txLogConn) Rollback() error { conn.inTx = false; return nil }
+func (conn *txLogConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	conn.driver.mu.Lock()
+	defer conn.driver.mu.Unlock()
+	conn.driver.statements = append(conn.driver.statements, loggedStatement{query: query, inTx: conn.inTx})
+	return txLogResult{}, nil
+}
+
+type txLogResult struct{}
+
+func (txLogResult) LastInsertId() (int64, error) { return 1, nil }
+func (txLogResult) RowsAffected() (int64, error) { return 1, nil }
+
+var txLog = &txLogDriver{}
+
+func init() {
+	sql.Register("txlog", txLog)
+}
+
+func TestUserWritesJoinTheRequestTransaction(t *testing.T) {
+	logDB, err := sql.Open("txlog", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := db
+	db = logDB
+	t.Cleanup(func() {
+		db = saved
+		logDB.Close()
+	})
+
+	txLog.mu.Lock()
+	txLog.statements = nil
+	txLog.mu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	ctx := context.WithValue(context.Background(), requestTxKey{}, tx)
+
+	if err := (mysqlUserRepository{}).SetSecretHash(ctx, 1, apiKeyColumn, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (mysqlUserRepository{}).Create(ctx, "jane@example.com", []byte("hash"), benchmarkCompletedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := 0
+	for _, statement := range txLog.statements {
+		if !statement.inTx {
+			t.Errorf("%q ran outside the request transaction", statement.query)
+		}
+		if strings.HasPrefix(statement.query, "UPDATE users") || strings.HasPrefix(statement.query, "INSERT INTO users") {
+			writes++
+		}
+	}
+	if writes != 2 {
+		t.Errorf("got %d writes, want 2", writes)
+	}
+}
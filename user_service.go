@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userService holds the account rules that do not depend on HTTP: hashing
+// passwords, matching emails case-insensitively and issuing integration
+// secrets, of which only hashes are stored.
+type userService struct {
+	repo userRepository
+}
+
+// Register creates an account, or returns errEmailTaken.
+func (service userService) Register(ctx context.Context, email, password string) (user, error) {
+	if len(password) > maxPasswordBytes {
+		return user{}, errPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user{}, err
+	}
+
+	u := user{Email: strings.ToLower(email), CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	u.ID, err = service.repo.Create(ctx, u.Email, hash, u.CreatedAt)
+	return u, err
+}
+
+// Login returns the user the email and password belong to, or
+// errInvalidCredentials without telling which of them was wrong.
+func (service userService) Login(ctx context.Context, email, password string) (user, error) {
+	u, hash, err := service.repo.ByEmail(ctx, strings.ToLower(email))
+	if errors.Is(err, errUserNotFound) {
+		return user{}, errInvalidCredentials
+	} else if err != nil {
+		return user{}, err
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return user{}, errInvalidCredentials
+	}
+	return u, nil
+}
+
+// IssueSecret replaces the user's secret in column (feedTokenColumn or
+// apiKeyColumn) and returns the new one.
+func (service userService) IssueSecret(ctx context.Context, userID int64, column string) (string, error) {
+	secret := newIntegrationSecret()
+	hash := hashIntegrationSecret(secret)
+	return secret, service.repo.SetSecretHash(ctx, userID, column, &hash)
+}
+
+func (service userService) RevokeSecret(ctx context.Context, userID int64, column string) error {
+	return service.repo.SetSecretHash(ctx, userID, column, nil)
+}
+
+// UserBySecret returns the user a secret was issued to, or 0 when it was
+// never issued or has been replaced.
+func (service userService) UserBySecret(ctx context.Context, column, secret string) (int64, error) {
+	if secret == "" {
+		return 0, nil
+	}
+	return service.repo.BySecretHash(ctx, column, hashIntegrationSecret(secret))
+}
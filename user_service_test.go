@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryUserRepository is a userRepository over a slice, for testing
+// userService without MySQL.
+type memoryUserRepository struct {
+	mu      sync.Mutex
+	users   []memoryUser
+	secrets map[string]map[int64]string
+}
+
+type memoryUser struct {
+	user
+	passwordHash []byte
+}
+
+func newMemoryUserRepository() *memoryUserRepository {
+	return &memoryUserRepository{secrets: map[string]map[int64]string{}}
+}
+
+func (repo *memoryUserRepository) Create(_ context.Context, email string, passwordHash []byte, createdAt time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, existing := range repo.users {
+		if existing.Email == email {
+			return 0, errEmailTaken
+		}
+	}
+	id := int64(len(repo.users) + 1)
+	repo.users = append(repo.users, memoryUser{
+		user:         user{ID: id, Email: email, CreatedAt: createdAt},
+		passwordHash: passwordHash,
+	})
+	return id, nil
+}
+
+func (repo *memoryUserRepository) ByEmail(_ context.Context, email string) (user, []byte, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, existing := range repo.users {
+		if existing.Email == email {
+			return existing.user, existing.passwordHash, nil
+		}
+	}
+	return user{}, nil, errUserNotFound
+}
+
+func (repo *memoryUserRepository) SetSecretHash(_ context.Context, userID int64, column string, hash *string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.secrets[column] == nil {
+		repo.secrets[column] = map[int64]string{}
+	}
+	if hash == nil {
+		delete(repo.secrets[column], userID)
+	} else {
+		repo.secrets[column][userID] = *hash
+	}
+	return nil
+}
+
+func (repo *memoryUserRepository) BySecretHash(_ context.Context, column, hash string) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for userID, stored := range repo.secrets[column] {
+		if stored == hash {
+			return userID, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestUserServiceRegister(t *testing.T) {
+	ctx := context.Background()
+	users := userService{repo: newMemoryUserRepository()}
+
+	registered, err := users.Register(ctx, "Jane@Example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.ID == 0 || registered.Email != "jane@example.com" {
+		t.Errorf("got %+v, want an id and the lowercased email", registered)
+	}
+
+	if _, err := users.Register(ctx, "JANE@example.com", "another one"); !errors.Is(err, errEmailTaken) {
+		t.Errorf("registering the email again: got %v, want errEmailTaken", err)
+	}
+	if _, err := users.Register(ctx, "joe@example.com", strings.Repeat("é", 37)); err != errPasswordTooLong {
+		t.Errorf("74-byte password: got %v, want errPasswordTooLong", err)
+	}
+}
+
+func TestUserServiceLogin(t *testing.T) {
+	ctx := context.Background()
+	users := userService{repo: newMemoryUserRepository()}
+	registered, err := users.Register(ctx, "jane@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggedIn, err := users.Login(ctx, "JANE@example.com", "correct horse")
+	if err != nil || loggedIn.ID != registered.ID {
+		t.Errorf("got %+v, %v, want user %d", loggedIn, err, registered.ID)
+	}
+	if _, err := users.Login(ctx, "jane@example.com", "wrong horse"); !errors.Is(err, errInvalidCredentials) {
+		t.Errorf("wrong password: got %v, want errInvalidCredentials", err)
+	}
+	if _, err := users.Login(ctx, "joe@example.com", "correct horse"); !errors.Is(err, errInvalidCredentials) {
+		t.Errorf("unknown email: got %v, want errInvalidCredentials", err)
+	}
+}
+
+func TestUserServiceSecrets(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryUserRepository()
+	users := userService{repo: repo}
+
+	first, err := users.IssueSecret(ctx, 7, apiKeyColumn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.secrets[apiKeyColumn][7] == first {
+		t.Error("the secret was stored instead of its hash")
+	}
+	if userID, _ := users.UserBySecret(ctx, apiKeyColumn, first); userID != 7 {
+		t.Errorf("got user %d for the issued secret, want 7", userID)
+	}
+	if userID, _ := users.UserBySecret(ctx, feedTokenColumn, first); userID != 0 {
+		t.Errorf("got user %d for the secret in another column, want 0", userID)
+	}
+
+	second, err := users.IssueSecret(ctx, 7, apiKeyColumn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, _ := users.UserBySecret(ctx, apiKeyColumn, first); userID != 0 {
+		t.Errorf("got user %d for a replaced secret, want 0", userID)
+	}
+
+	if err := users.RevokeSecret(ctx, 7, apiKeyColumn); err != nil {
+		t.Fatal(err)
+	}
+	if userID, _ := users.UserBySecret(ctx, apiKeyColumn, second); userID != 0 {
+		t.Errorf("got user %d for a revoked secret, want 0", userID)
+	}
+	if userID, _ := users.UserBySecret(ctx, apiKeyColumn, ""); userID != 0 {
+		t.Errorf("got user %d for an empty secret, want 0", userID)
+	}
+}
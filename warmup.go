@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// primeCaches runs in the background on startup when WARM_CACHES is set, so
+// the first requests after a deploy do not all hit the database at once. It
+// fills the heatmap cache for the current and the previous year, the ones
+// dashboards request right after a deploy, for every user who completed a
+// todo in that time. It stops early when ctx is cancelled.
+//
+// The heatmap cache is the only cache: list pages and the estimates report
+// share concurrent queries but keep nothing, so there is nothing to prime.
+func primeCaches(ctx context.Context, todos todoService) {
+	start := time.Now()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	years := []int{today.Year(), today.Year() - 1}
+
+	userIDs, err := todos.UsersWithCompletionsSince(ctx, time.Date(years[1], time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		slog.Warn("warming heatmap cache failed", "error", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			slog.Info("warming heatmap cache stopped")
+			return
+		}
+		for _, year := range years {
+			if _, err := todos.CompletionsBefore(ctx, userID, year, today); err != nil {
+				slog.Warn("warming heatmap cache failed", "user_id", userID, "year", year, "error", err)
+				return
+			}
+		}
+	}
+	slog.Info("caches warmed", "users", len(userIDs), "duration", time.Since(start).Round(time.Millisecond).String())
+}
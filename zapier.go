@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const zapierTriggerLimit = 100
+
+type completedTodoTrigger struct {
+	ID          string    `json:"id"`
+	TodoID      int       `json:"todo_id"`
+	Item        string    `json:"item"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+type completeTodoPayload struct {
+	ID int64 `json:"id" binding:"required,min=1"`
+}
+
+// requireAPIKey authenticates Zapier/IFTTT by the API key a user issued
+// through POST /me/api-key, sent in the X-API-Key header, and acts on behalf
+// of that user.
+func requireAPIKey(users userService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		userID, err := users.UserBySecret(ginContext.Request.Context(), apiKeyColumn, ginContext.GetHeader("X-API-Key"))
+		if err != nil {
+			ginContext.Error(err)
+			ginContext.Abort()
+			return
+		}
+		if userID == 0 {
+			ginContext.Error(errInvalidAPIKey)
+			ginContext.Abort()
+			return
+		}
+		ginContext.Set(userIDKey, userID)
+		ginContext.Next()
+	}
+}
+
+// getZapierMe is the connection test Zapier calls when an account is linked.
+func getZapierMe(ginContext *gin.Context) {
+	ginContext.JSON(http.StatusOK, gin.H{"authenticated": true})
+}
+
+// Polling triggers return the newest items first; Zapier de-duplicates them
+// by their "id" field.
+func getNewTodoTrigger(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		newest, err := todos.Newest(ginContext.Request.Context(), currentUserID(ginContext), zapierTriggerLimit)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, newest)
+	}
+}
+
+func getTodoCompletedTrigger(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		completed, err := todos.RecentlyCompleted(ginContext.Request.Context(), currentUserID(ginContext), zapierTriggerLimit)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		var completions = make([]completedTodoTrigger, 0, len(completed))
+		for _, t := range completed {
+			completions = append(completions, completedTodoTrigger{
+				// Completing a todo again after reopening it is a new event.
+				ID:          fmt.Sprintf("%d-%d", t.ID, t.CompletedAt.Unix()),
+				TodoID:      t.ID,
+				Item:        t.Item,
+				CompletedAt: *t.CompletedAt,
+			})
+		}
+
+		ginContext.JSON(http.StatusOK, completions)
+	}
+}
+
+func completeTodoAction(todos todoService) gin.HandlerFunc {
+	return func(ginContext *gin.Context) {
+		var payload completeTodoPayload
+		if err := ginContext.ShouldBindJSON(&payload); err != nil {
+			ginContext.Error(validationError(err))
+			return
+		}
+
+		completedTodo, err := todos.Complete(ginContext.Request.Context(), currentUserID(ginContext), payload.ID)
+		if err != nil {
+			ginContext.Error(err)
+			return
+		}
+
+		ginContext.JSON(http.StatusOK, completedTodo)
+	}
+}